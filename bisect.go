@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+
+	"github.com/desal/go-getx/getx"
+	"github.com/desal/richtext"
+	"github.com/jawher/mow.cli"
+)
+
+func bisect(cmd *cli.Cmd) {
+	cmd.Spec = "[-v] [-c] LOCKFILE TEST"
+
+	var (
+		verbose = cmd.BoolOpt("v verbose", false, "Verbose output")
+		commits = cmd.BoolOpt("c commits", false, "Also bisect the commits of the update to blame")
+
+		lockFile = cmd.StringArg("LOCKFILE", "", "Lockfile written before the update")
+		test     = cmd.StringArg("TEST", "", "Command that fails since the update (e.g. 'go test ./...')")
+	)
+
+	cmd.Action = func() {
+		format := richtext.New()
+		flags := []getx.Flag{getx.RecurseTopLevel, getx.Warn}
+
+		if *verbose {
+			flags = append(flags, getx.Verbose)
+		}
+
+		lock, err := getx.LoadLockFromFile(*lockFile)
+		if err != nil {
+			format.ErrorLine("%s", err)
+			os.Exit(1)
+		}
+
+		goPath := envGoPath(format)
+
+		ctx := getx.New(format, goPath, getx.RuleSet{}, "", flags...)
+		result, err := ctx.Bisect(".", lock, *test, *commits)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		format.PrintLine("%s (%s) broke '%s' after %d tests", result.Pkg, result.Dir, *test, result.Tests)
+		if result.Log != "" {
+			format.PrintLine("first failing commit: %s", result.Log)
+		} else {
+			format.PrintLine("update to: %s", result.Commit)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package getx
+
+import (
+	"sort"
+
+	"github.com/desal/dsutil"
+)
+
+//Bisect finds which repository update broke a test command, by checking out
+//a growing prefix of the updates on top of a lockfile taken before them. Like
+//git bisect it assumes a single update is to blame; when two only fail
+//together the later of them (in package order) is reported.
+
+type BisectResult struct {
+	Pkg    string // Repository whose update made the test fail
+	Dir    string
+	Commit string // With commits, the first commit in Pkg that fails
+	Log    string // The commit's summary line
+	Tests  int    // Number of times the test command was run
+}
+
+type bisectRepo struct {
+	pkg    string
+	vcs    VCS
+	dir    string
+	good   string // Commit in the lockfile
+	bad    string // Commit checked out now
+	branch string // Branch checked out now, "" if detached
+}
+
+//Bisect runs test (a shell command, run in workingDir) against repositories
+//checked out at the commits in good, and then with the updates since made to
+//them, to find the update that makes test fail. With commits, it goes on to
+//bisect the commits of that update. Every repository is left where it was.
+func (c *Context) Bisect(workingDir string, good Lock, test string, commits bool) (BisectResult, error) {
+	repos := []*bisectRepo{}
+	for _, e := range good.Repos {
+		goDir, alreadyExists := c.goCtx.Dir(workingDir, e.Pkg)
+		vcs, isRepo := c.repoVCS(goDir)
+		if !alreadyExists || !isRepo {
+			c.verbosef("%s not checked out, ignoring", e.Pkg)
+			continue
+		}
+		if clean, status, err := vcs.Status(goDir); err != nil {
+			return BisectResult{}, c.errorf("Failed to get %s status for package %s (%s): %s",
+				vcs.Name(), e.Pkg, goDir, err.Error())
+		} else if !clean {
+			return BisectResult{}, c.fail(ErrDirty, e.Pkg, goDir, nil, "Not bisecting package %s (%s), %s status is %s",
+				e.Pkg, goDir, vcs.Name(), status)
+		}
+
+		r := &bisectRepo{pkg: e.Pkg, vcs: vcs, dir: goDir, good: e.Commit}
+		r.bad, _ = vcs.Head(goDir)
+		r.branch, _ = vcs.Branch(goDir)
+		if r.bad != r.good {
+			repos = append(repos, r)
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].pkg < repos[j].pkg })
+	defer c.bisectReset(repos)
+
+	result := BisectResult{}
+	run := func(what string) bool {
+		result.Tests++
+		c.verbosef("Testing %s", what)
+		_, _, err := c.cmdCtx.Execf("cd %s && %s", dsutil.PosixPath(workingDir), test)
+		return err == nil
+	}
+
+	if len(repos) == 0 {
+		return result, c.errorf("No repositories have been updated since the lockfile")
+	} else if passed := run("with every update"); passed {
+		return result, c.errorf("'%s' passes with every update, nothing to bisect", test)
+	}
+
+	//The first n repositories are on their update, the rest on the lockfile.
+	checkout := func(n int) error {
+		for i, r := range repos {
+			commit := r.good
+			if i < n {
+				commit = r.bad
+			}
+			if err := c.checkoutRef(r.vcs, r.dir, commit); err != nil {
+				return c.errorf("Failed to checkout %s for package %s (%s): %s",
+					commit, r.pkg, r.dir, err.Error())
+			}
+		}
+		return nil
+	}
+
+	if err := checkout(0); err != nil {
+		return result, err
+	} else if passed := run("without updates"); !passed {
+		return result, c.errorf("'%s' fails without updates, nothing to bisect", test)
+	}
+
+	//Invariant: passes with lo updates, fails with hi.
+	lo, hi := 0, len(repos)
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if err := checkout(mid); err != nil {
+			return result, err
+		}
+		passed := run("with updates to " + repos[mid-1].pkg + " and before")
+		if passed {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	culprit := repos[hi-1]
+	result.Pkg, result.Dir, result.Commit = culprit.pkg, culprit.dir, culprit.bad
+	if !commits {
+		return result, nil
+	}
+
+	if err := checkout(hi - 1); err != nil {
+		return result, err
+	}
+	list, err := culprit.vcs.Commits(culprit.dir, culprit.good, culprit.bad)
+	if err != nil {
+		return result, c.errorf("Failed to list commits for package %s (%s): %s",
+			culprit.pkg, culprit.dir, err.Error())
+	}
+
+	//Invariant: passes at list[lo] (or the lockfile's commit), fails at list[hi].
+	lo, hi = -1, len(list)-1
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		if err := culprit.vcs.Checkout(culprit.dir, list[mid]); err != nil {
+			return result, c.errorf("Failed to checkout %s for package %s (%s): %s",
+				list[mid], culprit.pkg, culprit.dir, err.Error())
+		}
+		passed := run(culprit.pkg + " at " + shortCommit(list[mid]))
+		if passed {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	if hi >= 0 {
+		result.Commit = list[hi]
+		if lines, _ := culprit.vcs.Log(culprit.dir, result.Commit+"^", result.Commit); len(lines) == 1 {
+			result.Log = lines[0]
+		}
+	}
+	return result, nil
+}
+
+func (c *Context) bisectReset(repos []*bisectRepo) {
+	for _, r := range repos {
+		if err := r.vcs.Rollback(r.dir, r.branch, r.bad); err != nil {
+			c.warnf("Failed to put package %s (%s) back on %s: %s", r.pkg, r.dir, r.bad, err.Error())
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package getx
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBisect(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1", "gh/u3/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+	repos.AddRepo("gh/u3/p1",
+		Pkg("gh/u3/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		good, err := ctx.Lock()
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		upstreamf(t, format, ruleSet.Rules[1].Replace,
+			`git commit -q --allow-empty -m "harmless"`,
+			"git push -q origin master")
+		broken := upstreamf(t, format, ruleSet.Rules[2].Replace,
+			`git commit -q --allow-empty -m "fine"`,
+			"touch BROKEN && git add BROKEN",
+			`git commit -q -m "break it"`,
+			"git push -q origin master")
+		upstreamf(t, format, ruleSet.Rules[2].Replace,
+			`git commit -q --allow-empty -m "after"`,
+			"git push -q origin master")
+
+		updateCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update)
+		assert.Nil(t, updateCtx.Get(".", "gh/u1/p1", false, false))
+		p3Dir := filepath.Join(goPath[0], "src", "gh", "u3", "p1")
+		updated := updateCtx.head(p3Dir)
+
+		test := "test ! -e " + filepath.Join(p3Dir, "BROKEN")
+		bisectCtx := New(format, goPath, ruleSet, "", Warn, RecurseTopLevel)
+		result, err := bisectCtx.Bisect(".", good, test, false)
+		assert.Nil(t, err)
+		assert.Equal(t, "gh/u3/p1", result.Pkg)
+		assert.Equal(t, updated, result.Commit)
+		assert.Equal(t, updated, bisectCtx.head(p3Dir))
+
+		result, err = bisectCtx.Bisect(".", good, test, true)
+		assert.Nil(t, err)
+		assert.Equal(t, "gh/u3/p1", result.Pkg)
+		assert.Equal(t, broken[:7]+" break it", result.Log)
+		assert.Equal(t, updated, bisectCtx.head(p3Dir))
+
+		_, err = bisectCtx.Bisect(".", good, "true", false)
+		assert.NotNil(t, err)
+	})
+}
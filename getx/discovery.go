@@ -0,0 +1,221 @@
+package getx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//When no rule matches, a RuleSet with a Discovery falls back to what go get
+//does: fetch https://<import path>?go-get=1 and look for go-import meta tags
+//declaring the repository root and url. As with go get, a root above the
+//import path is only trusted if its own page declares the same, and pages
+//returned with an error status are ignored. Results are cached per root, so
+//every package in a repository only costs the first lookup.
+
+var ErrDiscovery = errors.New("discovery failed")
+
+//MetaImport is a <meta name="go-import" content="prefix vcs repo"> tag.
+type MetaImport struct {
+	Prefix   string
+	VCS      string
+	RepoRoot string
+}
+
+//MetaSource is a <meta name="go-source" content="prefix home dir file"> tag.
+type MetaSource struct {
+	Prefix    string
+	Home      string
+	Directory string
+	File      string
+}
+
+//Discovered is what discovery found for an import path.
+type Discovered struct {
+	Import MetaImport
+	Source *MetaSource // nil if the page has no matching go-source tag
+}
+
+type Discovery struct {
+	Client *http.Client
+
+	mu     sync.Mutex
+	roots  map[string]Discovered // Keyed by prefix
+	failed map[string]error      // Keyed by import path
+}
+
+func NewDiscovery(client *http.Client) *Discovery {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Discovery{
+		Client: client,
+		roots:  map[string]Discovered{},
+		failed: map[string]error{},
+	}
+}
+
+//Discover returns the go-import (and go-source) declared for pkg.
+func (d *Discovery) Discover(pkg string) (Discovered, error) {
+	d.mu.Lock()
+	for prefix, discovered := range d.roots {
+		if pkgContains(prefix, pkg) {
+			d.mu.Unlock()
+			return discovered, nil
+		}
+	}
+	if err, ok := d.failed[pkg]; ok {
+		d.mu.Unlock()
+		return Discovered{}, err
+	}
+	d.mu.Unlock()
+
+	discovered, err := d.fetch(pkg)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		d.failed[pkg] = err
+	} else {
+		d.roots[discovered.Import.Prefix] = discovered
+	}
+	return discovered, err
+}
+
+func (d *Discovery) fetch(pkg string) (Discovered, error) {
+	url, imports, sources, err := d.fetchMeta(pkg, pkg)
+	if err != nil {
+		return Discovered{}, err
+	}
+
+	matching := matchingImports(imports, pkg)
+	if len(matching) == 0 {
+		return Discovered{}, newError(ErrDiscovery, pkg, "", nil, "No go-import meta tag for %s at %s",
+			pkg, url)
+	} else if len(matching) > 1 {
+		return Discovered{}, newError(ErrDiscovery, pkg, "", nil, "Multiple go-import meta tags for %s at %s",
+			pkg, url)
+	} else if !isVCSName(matching[0].VCS) {
+		return Discovered{}, newError(ErrDiscovery, pkg, "", nil, "Unsupported vcs %s for %s at %s",
+			matching[0].VCS, pkg, url)
+	}
+
+	if prefix := matching[0].Prefix; prefix != pkg {
+		//Anyone able to serve a page below the root could claim it otherwise
+		rootUrl, rootImports, _, err := d.fetchMeta(pkg, prefix)
+		if err != nil {
+			return Discovered{}, err
+		}
+		confirmed := matchingImports(rootImports, prefix)
+		if len(confirmed) != 1 || confirmed[0] != matching[0] {
+			return Discovered{}, newError(ErrDiscovery, pkg, "", nil, "%s declares root %s, but %s doesn't confirm it",
+				url, prefix, rootUrl)
+		}
+	}
+
+	discovered := Discovered{Import: matching[0]}
+	for i, source := range sources {
+		if source.Prefix == discovered.Import.Prefix {
+			discovered.Source = &sources[i]
+			break
+		}
+	}
+	return discovered, nil
+}
+
+//fetchMeta fetches the go-get page for importPath, while discovering pkg.
+func (d *Discovery) fetchMeta(pkg, importPath string) (string, []MetaImport, []MetaSource, error) {
+	url := "https://" + importPath + "?go-get=1"
+	resp, err := d.Client.Get(url)
+	if err != nil {
+		return url, nil, nil, newError(ErrDiscovery, pkg, "", err, "Failed to fetch %s: %s", url, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return url, nil, nil, newError(ErrDiscovery, pkg, "", nil, "Failed to fetch %s: status %s", url, resp.Status)
+	}
+
+	imports, sources, err := ParseMeta(resp.Body)
+	if err != nil {
+		return url, nil, nil, newError(ErrDiscovery, pkg, "", err, "Failed to parse %s: %s", url, err.Error())
+	}
+	return url, imports, sources, nil
+}
+
+//matchingImports returns the go-import tags for a root containing pkg.
+func matchingImports(imports []MetaImport, pkg string) []MetaImport {
+	matching := []MetaImport{}
+	for _, imp := range imports {
+		if imp.VCS != "mod" && pkgContains(imp.Prefix, pkg) {
+			matching = append(matching, imp)
+		}
+	}
+	return matching
+}
+
+//ParseMeta reads the go-import and go-source meta tags from the head of an
+//html page, the same way go get does.
+func ParseMeta(r io.Reader) ([]MetaImport, []MetaSource, error) {
+	imports := []MetaImport{}
+	sources := []MetaSource{}
+
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "ascii":
+			return input, nil
+		}
+		return nil, fmt.Errorf("can't decode charset %q", charset)
+	}
+
+	for {
+		t, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if len(imports) > 0 || len(sources) > 0 {
+				break
+			}
+			return nil, nil, err
+		}
+
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			break
+		} else if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			break
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+
+		fields := strings.Fields(attrValue(e.Attr, "content"))
+		switch attrValue(e.Attr, "name") {
+		case "go-import":
+			if len(fields) == 3 {
+				imports = append(imports, MetaImport{fields[0], fields[1], fields[2]})
+			}
+		case "go-source":
+			if len(fields) == 4 {
+				sources = append(sources, MetaSource{fields[0], fields[1], fields[2], fields[3]})
+			}
+		}
+	}
+	return imports, sources, nil
+}
+
+func attrValue(attrs []xml.Attr, name string) string {
+	for _, a := range attrs {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
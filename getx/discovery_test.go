@@ -0,0 +1,91 @@
+package getx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMeta(t *testing.T) {
+	imports, sources, err := ParseMeta(strings.NewReader(`<!DOCTYPE html>
+<html><head>
+<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+<meta name="go-import" content="example.org/hats git https://git.example.org/hats.git">
+<meta name="go-import" content="example.org/hats mod https://proxy.example.org">
+<meta name="go-source" content="example.org/hats https://example.org/hats https://example.org/hats/tree{/dir} https://example.org/hats/blob{/dir}/{file}">
+</head>
+<body><meta name="go-import" content="example.org/ignored git https://ignored"></body>
+</html>`))
+	assert.Nil(t, err)
+	assert.Equal(t, []MetaImport{
+		{"example.org/hats", "git", "https://git.example.org/hats.git"},
+		{"example.org/hats", "mod", "https://proxy.example.org"},
+	}, imports)
+	if assert.Len(t, sources, 1) {
+		assert.Equal(t, "https://example.org/hats/blob{/dir}/{file}", sources[0].File)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		host := r.Host
+		switch {
+		case r.URL.Query().Get("go-get") != "1":
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/a/hats"):
+			fmt.Fprintf(w, `<html><head><meta name="go-import" content="%s/a/hats git https://git.example.org/hats.git">
+<meta name="go-source" content="%s/a/hats https://example.org/hats _ _"></head></html>`, host, host)
+		case r.URL.Path == "/d/evil":
+			fmt.Fprintf(w, `<meta name="go-import" content="%s/d git https://evil.example.org/d.git">`, host)
+		case r.URL.Path == "/e/lost":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `<meta name="go-import" content="%s/e/lost git https://git.example.org/lost.git">`, host)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	rules, _ := LoadRules(strings.NewReader("b/([^/]+)=http://server/repos/$1.git\n"))
+	rules.Discovery = NewDiscovery(server.Client())
+
+	root, url, err := rules.GetUrl(host + "/a/hats/top")
+	assert.Nil(t, err)
+	assert.Equal(t, host+"/a/hats", root)
+	assert.Equal(t, "https://git.example.org/hats.git", url)
+
+	root, url, err = rules.GetUrl(host + "/a/hats/brim")
+	assert.Nil(t, err)
+	assert.Equal(t, host+"/a/hats", root)
+	assert.Equal(t, 2, requests, "the root should be confirmed, then cached for a second package")
+
+	discovered, err := rules.Discovery.Discover(host + "/a/hats")
+	if assert.Nil(t, err) && assert.NotNil(t, discovered.Source) {
+		assert.Equal(t, "https://example.org/hats", discovered.Source.Home)
+	}
+
+	_, url, err = rules.GetUrl("b/shoes")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://server/repos/shoes.git", url)
+	assert.Equal(t, 2, requests, "rules should be tried before discovery")
+
+	_, _, err = rules.GetUrl(host + "/c/socks")
+	assert.True(t, errors.Is(err, ErrNoRule))
+	assert.True(t, errors.Is(err, ErrDiscovery))
+	_, _, err = rules.GetUrl(host + "/c/socks")
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, requests, "failures should be cached")
+
+	_, _, err = rules.GetUrl(host + "/d/evil")
+	assert.True(t, errors.Is(err, ErrDiscovery), "a root its own page doesn't declare isn't trusted")
+	_, _, err = rules.GetUrl(host + "/e/lost")
+	assert.True(t, errors.Is(err, ErrDiscovery), "meta tags on an error page aren't trusted")
+}
@@ -0,0 +1,116 @@
+package getx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//Every failure with a known cause is returned as an *Error, so callers can
+//use errors.Is with one of the sentinels below, or errors.As to get at the
+//package and the underlying git/command error.
+
+var (
+	ErrNoRule        = errors.New("no matching rule")
+	ErrNotRepository = errors.New("not in a repository")
+	ErrDirty         = errors.New("dirty working tree") // From Restore, Get only skips the update (see Result.Err)
+	ErrClone         = errors.New("clone failed")
+	ErrHook          = errors.New("hook failed")
+	ErrOutsideGoPath = errors.New("package outside GOPATH")
+	ErrInstall       = errors.New("install failed")
+	ErrConflict      = errors.New("conflicting requirements")
+	ErrVerify        = errors.New("verification failed")
+)
+
+type Error struct {
+	Kind error // One of the Err sentinels
+	Pkg  string
+	Dir  string
+	Err  error // Underlying error, may be nil
+	msg  string
+}
+
+func (e *Error) Error() string { return e.msg }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) Is(target error) bool { return target == e.Kind }
+
+func newError(kind error, pkg, goDir string, cause error, s string, a ...interface{}) *Error {
+	return &Error{Kind: kind, Pkg: pkg, Dir: goDir, Err: cause, msg: fmt.Sprintf(s, a...)}
+}
+
+//fail reports an error of a known kind the same way errorf does.
+func (c *Context) fail(kind error, pkg, goDir string, cause error, s string, a ...interface{}) error {
+	return c.report(newError(kind, pkg, goDir, cause, s, a...))
+}
+
+func (c *Context) errorf(s string, a ...interface{}) error {
+	return c.report(fmt.Errorf(s, a...))
+}
+
+func (c *Context) report(err error) error {
+	c.outputMu.Lock()
+	defer c.outputMu.Unlock()
+
+	if c.flags.Checked(MustExit) {
+		c.format.ErrorLine("%s", err.Error())
+		os.Exit(1)
+	} else if c.flags.Checked(MustPanic) {
+		panic(err)
+	} else if c.flags.Checked(Warn) || c.flags.Checked(Verbose) {
+		c.format.WarningLine("%s", err.Error())
+	}
+	return err
+}
+
+//ChainError is a failure collected with the KeepGoing flag, along with the
+//imports that led to the failing package.
+type ChainError struct {
+	Chain []string
+	Err   error
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("%s: %s", strings.Join(e.Chain, " -> "), e.Err.Error())
+}
+
+func (e *ChainError) Unwrap() error { return e.Err }
+
+//MultiError holds every failure collected with the KeepGoing flag.
+type MultiError []*ChainError
+
+func (m MultiError) Error() string {
+	lines := []string{}
+	for _, e := range m {
+		lines = append(lines, e.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m MultiError) Unwrap() []error {
+	errs := []error{}
+	for _, e := range m {
+		errs = append(errs, e)
+	}
+	return errs
+}
+
+func (c *Context) keepGoing(err error, chain []string) {
+	c.errsMu.Lock()
+	defer c.errsMu.Unlock()
+	c.errs = append(c.errs, &ChainError{Chain: chain, Err: err})
+}
+
+//collectedErrors returns the failures collected since it was last called.
+func (c *Context) collectedErrors() error {
+	c.errsMu.Lock()
+	defer c.errsMu.Unlock()
+	if len(c.errs) == 0 {
+		return nil
+	}
+	errs := c.errs
+	c.errs = nil
+	return errs
+}
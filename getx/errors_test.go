@@ -0,0 +1,76 @@
+package getx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorKinds(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(format, goPath, ruleSet, "", RecurseTopLevel)
+		err := ctx.Get(".", "gh/u1/p1", false, false)
+		assert.True(t, errors.Is(err, ErrNoRule))
+		assert.False(t, errors.Is(err, ErrClone))
+
+		var getxErr *Error
+		if assert.True(t, errors.As(err, &getxErr)) {
+			assert.Equal(t, "gh/u2/p1", getxErr.Pkg)
+			assert.Equal(t, "Could not find a rule matching gh/u2/p1", getxErr.Error())
+		}
+
+		notGitDir := filepath.Join(goPath[0], "src", "gh", "u3", "p1")
+		assert.Nil(t, os.MkdirAll(notGitDir, 0755))
+		mockPackage(notGitDir, "gh/u3/p1", nil)
+
+		ctx = New(format, goPath, ruleSet, "", DeepScan)
+		err = ctx.Get(".", "gh/u3/p1", false, false)
+		assert.True(t, errors.Is(err, ErrNotRepository))
+		if assert.True(t, errors.As(err, &getxErr)) {
+			assert.Equal(t, notGitDir, getxErr.Dir)
+		}
+	})
+}
+
+func TestKeepGoing(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u1/p2"))
+	repos.AddRepo("gh/u1/p2",
+		Pkg("gh/u1/p2", "gh/u2/p1", "gh/u1/p3"))
+	repos.AddRepo("gh/u1/p3",
+		Pkg("gh/u1/p3", "gh/u3/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(format, goPath, ruleSet, "", RecurseTopLevel, KeepGoing)
+		err := ctx.Get(".", "gh/u1/p1", false, false)
+
+		multiErr, ok := err.(MultiError)
+		if !assert.True(t, ok) || !assert.Len(t, multiErr, 2) {
+			return
+		}
+		assert.True(t, errors.Is(err, ErrNoRule))
+
+		chains := [][]string{multiErr[0].Chain, multiErr[1].Chain}
+		assert.Contains(t, chains, []string{"gh/u1/p1", "gh/u1/p2", "gh/u2/p1"})
+		assert.Contains(t, chains, []string{"gh/u1/p1", "gh/u1/p2", "gh/u1/p3", "gh/u3/p1"})
+
+		//Everything resolvable was still fetched
+		_, p3Exists := ctx.goCtx.Dir(".", "gh/u1/p3")
+		assert.True(t, p3Exists)
+	})
+}
@@ -4,9 +4,9 @@ package getx
 
 import "fmt"
 
-const _Flag_name = "DeepScanUpdateInstallWarnMustExitMustPanicVerboseCmdVerboseApplyHooksTaggedOnly"
+const _Flag_name = "DeepScanUpdateInstallWarnMustExitMustPanicVerboseCmdVerboseApplyHooksTaggedOnlyRecurseTopLevelDryRunKeepGoingPrereleaseChangeLogTransactionalFixOriginRebaseForks"
 
-var _Flag_index = [...]uint8{0, 8, 14, 21, 25, 33, 42, 49, 59, 69, 79}
+var _Flag_index = [...]uint8{0, 8, 14, 21, 25, 33, 42, 49, 59, 69, 79, 94, 100, 109, 119, 128, 141, 150, 161}
 
 func (i Flag) String() string {
 	i -= 1
@@ -0,0 +1,57 @@
+package getx
+
+//A rule with an upstream=url attribute declares its repository a fork. The
+//fork is cloned and pulled as usual, with the upstream repository added as
+//the remote named UpstreamRemote. Updates report how many commits of the
+//upstream branch of the same name the fork is missing, and with the
+//RebaseForks flag rebase the checkout onto it. Nothing is pushed: a rebased
+//fork has to be force pushed to origin by hand (git push --force-with-lease),
+//otherwise the next update pulls the fork's old history back in on top.
+
+const UpstreamRemote = "upstream"
+
+//addUpstream adds (or repoints) the upstream remote of a fork.
+func (c *Context) addUpstream(vcs VCS, pkg, goDir string, remote Remote) error {
+	if remote.Upstream == "" {
+		return nil
+	}
+	if err := vcs.SetRemote(goDir, UpstreamRemote, remote.Upstream); err != nil {
+		return c.errorf("Failed to add upstream %s to package %s (%s): %s",
+			remote.Upstream, pkg, goDir, err.Error())
+	}
+	return nil
+}
+
+//compareUpstream records how far behind upstream a fork is, and with
+//RebaseForks rebases it. Failures are only warned about, as the fork itself
+//has already been updated.
+func (c *Context) compareUpstream(vcs VCS, pkg, goDir string, remote Remote) {
+	if remote.Upstream == "" {
+		return
+	}
+	branch, err := vcs.Branch(goDir)
+	if err != nil || branch == "" {
+		c.warnf("Not comparing package %s (%s) with upstream, not on a branch", pkg, goDir)
+		return
+	}
+
+	behind, err := vcs.Behind(goDir, UpstreamRemote, branch)
+	if err != nil {
+		c.warnf("Failed to compare package %s (%s) with upstream %s: %s",
+			pkg, goDir, remote.Upstream, err.Error())
+		return
+	}
+	c.result(pkg, goDir, func(r *Result) { r.UpstreamBehind = behind })
+	if behind == 0 || !c.flags.Checked(RebaseForks) {
+		return
+	}
+
+	if err := vcs.RebaseOnto(goDir, UpstreamRemote, branch); err != nil {
+		c.warnf("Failed to rebase package %s (%s) onto upstream %s, left as it was: %s",
+			pkg, goDir, branch, err.Error())
+		return
+	}
+	c.warnf("Package %s (%s) rebased onto upstream %s, force push it to origin before the next update",
+		pkg, goDir, branch)
+	c.result(pkg, goDir, func(r *Result) { r.RebasedOnUpstream = true })
+}
@@ -0,0 +1,58 @@
+package getx
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/cmd"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFork(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		forkUrl := ruleSet.Rules[1].Replace
+		upstreamUrl := filepath.Join(t.TempDir(), "upstream.git")
+		_, _, err := cmd.New(".", format, cmd.Warn).Execf("git clone -q --bare %s %s", forkUrl, upstreamUrl)
+		if !assert.Nil(t, err) {
+			return
+		}
+		ruleSet.Rules[1].Attrs["upstream"] = upstreamUrl
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		p2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		upstream, _ := ctx.gitf(p2Dir, "config --get remote.upstream.url")
+		assert.Equal(t, upstreamUrl, upstream)
+
+		upstreamf(t, format, forkUrl, `git commit -q --allow-empty -m "patch"`, "git push -q origin master")
+		upstreamHead := upstreamf(t, format, upstreamUrl,
+			`git commit -q --allow-empty -m "upstream one"`,
+			`git commit -q --allow-empty -m "upstream two"`,
+			"git push -q origin master")
+
+		updateCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update)
+		assert.Nil(t, updateCtx.Get(".", "gh/u1/p1", false, false))
+		results := updateCtx.Results()
+		assert.Equal(t, 2, results[1].UpstreamBehind)
+		assert.False(t, results[1].RebasedOnUpstream)
+
+		upstreamf(t, format, forkUrl, `git commit -q --allow-empty -m "another patch"`, "git push -q origin master")
+		rebaseCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update, RebaseForks)
+		assert.Nil(t, rebaseCtx.Get(".", "gh/u1/p1", false, false))
+		results = rebaseCtx.Results()
+		assert.Equal(t, 2, results[1].UpstreamBehind)
+		assert.True(t, results[1].RebasedOnUpstream)
+		base, _ := rebaseCtx.gitf(p2Dir, "rev-parse HEAD~2")
+		assert.Equal(t, upstreamHead, base)
+	})
+}
@@ -1,10 +1,11 @@
 package getx
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/desal/cmd"
 	"github.com/desal/dsutil"
@@ -22,16 +23,43 @@ type (
 	stringSet map[string]empty
 
 	Context struct {
-		doneGit     stringSet
-		doneGo      stringSet
-		format      richtext.Format
-		goPath      []string
-		cmdCtx      *cmd.Context
-		gitCtx      *git.Context
-		goCtx       *gocmd.Context
-		ruleSet     RuleSet
-		flags       flagSet
-		gitTopCache map[string]string
+		doneGit   *syncSet
+		doneGo    *syncSet
+		format    richtext.Format
+		goPath    []string
+		cmdCtx    *cmd.Context
+		goCtx     *gocmd.Context
+		vcs       []VCS
+		vcsCache  *syncMap
+		ruleSet   RuleSet
+		flags     flagSet
+		topCache  *syncMap
+		visited   *syncMap
+		repoLocks *keyedMutex
+		workers   workerPool
+		outputMu  sync.Mutex
+		pendingMu sync.Mutex
+		pending   []pendingInstall
+		plan      *plan
+		graph     *graph
+		results   *results
+		errsMu    sync.Mutex
+		errs      MultiError
+
+		constraint   *Constraint
+		requirements *requirements
+		txn          *transaction
+		policy       UpdatePolicy
+		keepOrigin   string
+	}
+
+	//A package that has been fetched, and is waiting to be installed once
+	//the whole dependency graph is present.
+	pendingInstall struct {
+		pkg     string
+		goDir   string
+		listed  []string
+		imports []string
 	}
 )
 
@@ -48,6 +76,13 @@ const (
 	ApplyHooks      //
 	TaggedOnly      //
 	RecurseTopLevel
+	DryRun
+	KeepGoing
+	Prerelease
+	ChangeLog
+	Transactional
+	FixOrigin
+	RebaseForks
 )
 
 func (fs flagSet) Checked(flag Flag) bool {
@@ -58,13 +93,26 @@ func (fs flagSet) Checked(flag Flag) bool {
 
 func New(format richtext.Format, goPath []string, ruleSet RuleSet, buildFlags string, flags ...Flag) *Context {
 	c := &Context{
-		doneGit:     stringSet{},
-		doneGo:      stringSet{},
-		format:      format,
-		goPath:      goPath,
-		ruleSet:     ruleSet,
-		flags:       flagSet{},
-		gitTopCache: map[string]string{},
+		doneGit:   newSyncSet(),
+		doneGo:    newSyncSet(),
+		format:    format,
+		goPath:    goPath,
+		ruleSet:   ruleSet,
+		flags:     flagSet{},
+		topCache:  newSyncMap(),
+		vcsCache:  newSyncMap(),
+		visited:   newSyncMap(),
+		repoLocks: newKeyedMutex(),
+		workers:   newWorkerPool(1),
+		plan:      &plan{index: map[string]int{}},
+		graph:     &graph{nodes: map[string]*GraphNode{}},
+		results:   &results{index: map[string]int{}},
+		txn:       &transaction{snapshots: map[string]snapshot{}},
+		policy:    PolicySkip,
+		requirements: &requirements{
+			reqs:    map[string][]requirement{},
+			settled: map[string]*settledRepo{},
+		},
 	}
 
 	cmdFlags := []cmd.Flag{cmd.Strict}
@@ -97,31 +145,33 @@ func New(format richtext.Format, goPath []string, ruleSet RuleSet, buildFlags st
 	}
 
 	c.cmdCtx = cmd.New(".", format, cmdFlags...)
-	c.gitCtx = git.New(format, gitFlags...)
+	c.vcs = []VCS{
+		&gitVCS{git.New(format, gitFlags...), c.cmdCtx},
+		&hgVCS{c.cmdCtx},
+	}
 	c.goCtx = gocmd.New(format, goPath, "", buildFlags, goFlags...)
 
 	return c
 }
 
-func (c *Context) errorf(s string, a ...interface{}) error {
-	if c.flags.Checked(MustExit) {
-		c.format.ErrorLine(s, a...)
-		os.Exit(1)
-	} else if c.flags.Checked(MustPanic) {
-		panic(fmt.Errorf(s, a...))
-	} else if c.flags.Checked(Warn) || c.flags.Checked(Verbose) {
-		c.format.WarningLine(s, a...)
-	}
-	return fmt.Errorf(s, a...)
+//SetJobs sets how many repositories may be cloned or inspected at once.
+func (c *Context) SetJobs(n int) {
+	c.workers = newWorkerPool(n)
 }
 
 func (c *Context) warnf(s string, a ...interface{}) {
+	c.outputMu.Lock()
+	defer c.outputMu.Unlock()
+
 	if c.flags.Checked(Warn) || c.flags.Checked(Verbose) {
 		c.format.WarningLine(s, a...)
 	}
 }
 
 func (c *Context) verbosef(s string, a ...interface{}) {
+	c.outputMu.Lock()
+	defer c.outputMu.Unlock()
+
 	if c.flags.Checked(Verbose) {
 		c.format.PrintLine(s, a...)
 	}
@@ -135,17 +185,13 @@ func pkgContains(parent, child string) bool {
 }
 
 func (c *Context) AlreadyDoneGit(pkg string) bool {
-	for donePkg, _ := range c.doneGit {
-		if pkgContains(donePkg, pkg) {
-			return true
-		}
-	}
-	return false
+	return c.doneGit.Any(func(donePkg string) bool {
+		return pkgContains(donePkg, pkg)
+	})
 }
 
 func (c *Context) AlreadyDoneGo(pkg string) bool {
-	_, ok := c.doneGo[pkg]
-	return ok
+	return c.doneGo.Has(pkg)
 }
 
 func stringInSlice(slice []string, s string) bool {
@@ -157,171 +203,343 @@ func stringInSlice(slice []string, s string) bool {
 	return false
 }
 
-func (c *Context) goToMostRecentTag(pkg, goDir string) error {
-	tags, err := c.gitCtx.Tags(goDir)
+//tagged is true if the repository should be moved to its highest version
+//tag, because of the TaggedOnly flag or a version constraint.
+func (c *Context) tagged(remote Remote) bool {
+	return !remote.Pinned() &&
+		(c.flags.Checked(TaggedOnly) || remote.Constraint != "" || c.constraint != nil)
+}
+
+//goToHighestTag checks out the highest version tag satisfying the rule's
+//constraint, or the one set with SetConstraint.
+func (c *Context) goToHighestTag(vcs VCS, pkg, goDir string, remote Remote) error {
+	constraint := c.constraint
+	if remote.Constraint != "" {
+		ruleConstraint, err := ParseConstraint(remote.Constraint)
+		if err != nil {
+			return c.errorf("Package %s (%s): %s", pkg, goDir, err.Error())
+		}
+		constraint = &ruleConstraint
+	}
+
+	tags, err := vcs.Tags(goDir)
 	if err != nil {
-		return c.errorf("Failed to get git tags for package %s (%s): %s",
-			pkg, goDir, err.Error())
+		return c.errorf("Failed to get %s tags for package %s (%s): %s",
+			vcs.Name(), pkg, goDir, err.Error())
 	}
 
-	mostRecentTag, err := c.gitCtx.MostRecentTag(goDir)
+	allTags, err := vcs.AllTags(goDir)
 	if err != nil {
-		return c.errorf("Failed to get most recent tag for package %s (%s): %s",
-			pkg, goDir, err.Error())
-	} else if mostRecentTag == "" {
-		c.warnf("Package %s (%s) has no tags", pkg, goDir)
+		return c.errorf("Failed to get %s tags for package %s (%s): %s",
+			vcs.Name(), pkg, goDir, err.Error())
+	}
+
+	highest, ok := HighestVersion(allTags, constraint, c.flags.Checked(Prerelease))
+	if !ok && constraint != nil {
+		c.warnf("Package %s (%s) has no version tags satisfying %s", pkg, goDir, constraint.String())
+		c.skipped(pkg, goDir, SkipNoTags)
+		return nil
+	} else if !ok {
+		c.warnf("Package %s (%s) has no version tags", pkg, goDir)
+		c.skipped(pkg, goDir, SkipNoTags)
 		return nil
 	}
 
-	if stringInSlice(tags, mostRecentTag) {
-		//Already pointing to latest tag
+	if stringInSlice(tags, highest.Tag) {
+		//Already pointing to highest tag
 		return nil
 	}
 
-	err = c.gitCtx.Checkout(goDir, mostRecentTag)
+	err = vcs.Checkout(goDir, highest.Tag)
 	if err != nil {
 		return c.errorf("Failed to checkout tag %s for pacakge %s (%s): %s",
-			mostRecentTag, pkg, goDir, err.Error())
-
-	} else {
-		return nil
+			highest.Tag, pkg, goDir, err.Error())
 	}
+	return nil
 }
 
-func (c *Context) clone(workingDir, pkg, goDir string, depsOnly, tests bool) (bool, error) {
+//SetConstraint makes Get checkout the highest version tag satisfying
+//constraint in every repository whose rule doesn't give its own.
+func (c *Context) SetConstraint(constraint Constraint) {
+	c.constraint = &constraint
+}
+
+func (c *Context) clone(workingDir, pkg, goDir string, chain []string, depsOnly, tests bool) (bool, error) {
 	if c.AlreadyDoneGit(pkg) {
 		return false, nil
 	}
 
-	rootPkg, gitUrl, err := c.ruleSet.GetUrl(pkg)
+	remote, err := c.ruleSet.Resolve(pkg)
+	rootPkg := remote.Root
 
 	if c.AlreadyDoneGit(rootPkg) {
-		c.doneGit[pkg] = empty{}
+		c.doneGit.Add(pkg)
 		return false, nil
 	}
 	if err != nil {
-		return true, c.errorf("%s", err.Error())
+		return true, c.report(err)
+	}
+
+	if rootPkg != pkg && c.flags.Checked(RecurseTopLevel) {
+		if !c.doneGo.Claim(rootPkg) {
+			//Another worker is already fetching the whole repository
+			c.doneGit.Add(pkg)
+			return false, nil
+		}
+		return false, c.get(workingDir, rootPkg, chain, depsOnly, tests)
+	}
+
+	unlock := c.repoLocks.Lock(rootPkg)
+	defer unlock()
+
+	if c.AlreadyDoneGit(rootPkg) {
+		//Cloned by another worker while we were waiting
+		c.doneGit.Add(pkg)
+		_, nowExists := c.goCtx.Dir(workingDir, pkg)
+		return nowExists, nil
 	}
 
 	if rootPkg != pkg {
-		if c.flags.Checked(RecurseTopLevel) {
-			return false, c.Get(workingDir, rootPkg, depsOnly, tests)
-		} else {
-			//This is a bit of a hack
-			//one other option would be to just recreate the path from GOPATH.
-			goDirSlash := filepath.ToSlash(goDir)
-			if !strings.HasSuffix(goDirSlash, pkg) {
-				return false, c.errorf("couldn't map %s in %s", pkg, goDir)
-			}
-			goDirNoPkg := strings.TrimSuffix(goDirSlash, pkg)
-			goDirRootPkg := goDirNoPkg + rootPkg
-			goDir = filepath.FromSlash(goDirRootPkg)
+		//This is a bit of a hack
+		//one other option would be to just recreate the path from GOPATH.
+		goDirSlash := filepath.ToSlash(goDir)
+		if !strings.HasSuffix(goDirSlash, pkg) {
+			return false, c.fail(ErrOutsideGoPath, pkg, goDir, nil, "couldn't map %s in %s", pkg, goDir)
 		}
+		goDirNoPkg := strings.TrimSuffix(goDirSlash, pkg)
+		goDirRootPkg := goDirNoPkg + rootPkg
+		goDir = filepath.FromSlash(goDirRootPkg)
 	}
 
-	err = c.gitCtx.Clone(goDir, gitUrl)
+	if c.flags.Checked(DryRun) {
+		c.planClone(rootPkg, goDir, remote)
+		c.doneGit.Add(pkg)
+		c.doneGit.Add(rootPkg)
+		return false, nil
+	}
+
+	c.workers.acquire()
+	defer c.workers.release()
+
+	vcs := c.vcsNamed(remote.VCS)
+	err = vcs.Clone(goDir, remote.Url)
 	if err != nil {
-		return true, c.errorf("Failed to clone %s:\n%s", gitUrl, err.Error())
+		return true, c.fail(ErrClone, rootPkg, goDir, err, "Failed to clone %s:\n%s", remote.Url, err.Error())
+	}
+	c.vcsCache.Set(goDir, vcs.Name())
+	c.snapshot(vcs, rootPkg, goDir, true)
+	if err := c.addUpstream(vcs, rootPkg, goDir, remote); err != nil {
+		return true, err
 	}
 
-	if c.flags.Checked(TaggedOnly) {
-		err := c.goToMostRecentTag(pkg, goDir)
+	if remote.Pinned() {
+		err := vcs.Checkout(goDir, remote.pin())
 		if err != nil {
-			return true, err
+			return true, c.errorf("Failed to checkout %s for package %s (%s): %s",
+				remote.pin(), rootPkg, goDir, err.Error())
 		}
 	}
 
-	c.doneGit[pkg] = empty{}
-	c.doneGit[rootPkg] = empty{}
+	err = c.settle(vcs, rootPkg, goDir, remote, chain, true, false)
+	if err != nil {
+		return true, err
+	}
+
+	commit, _ := vcs.Head(goDir)
+	c.result(rootPkg, goDir, func(r *Result) {
+		r.Cloned = true
+		r.ToCommit = commit
+	})
+
+	c.doneGit.Add(pkg)
+	c.doneGit.Add(rootPkg)
+	c.visited.Set(rootPkg, goDir)
 	return true, nil
 }
 
-func (c *Context) gitTopLevel(goDir string) (string, error) {
-	if cached, hasCache := c.gitTopCache[goDir]; hasCache {
+func (c *Context) topLevel(goDir string) (string, error) {
+	if cached, hasCache := c.topCache.Get(goDir); hasCache {
 		return cached, nil
 	}
-	v, err := c.gitCtx.TopLevel(goDir)
-	if err != nil {
-		c.gitTopCache[goDir] = v
+	vcs, ok := c.repoVCS(goDir)
+	if !ok {
+		return "", fmt.Errorf("%s is not in a repository", goDir)
+	}
+	v, err := vcs.TopLevel(goDir)
+	if err == nil {
+		c.topCache.Set(goDir, v)
 	}
 	return v, err
 }
 
-func (c *Context) inspect(workingDir, pkg, goDir string, depsOnly, tests bool) (bool, error) {
-	//never inspect twice
-	c.doneGo[pkg] = empty{}
+//repoRootPkg finds the package at the top level of the repository
+//containing pkg, along with the directory it lives in.
+func (c *Context) repoRootPkg(pkg, goDir string) (string, string, error) {
+	topLevel, err := c.topLevel(goDir)
+	if err != nil {
+		return "", "", c.fail(ErrNotRepository, pkg, goDir, err, "%s", err.Error())
+	}
 
-	isGit := c.gitCtx.IsGit(goDir)
-	if !isGit {
-		return true, c.errorf("Package %s (%s) is not a git repository", pkg, goDir)
+	nativePkg := filepath.FromSlash(pkg)
+
+	if !strings.HasSuffix(goDir, nativePkg) {
+		return "", "", c.fail(ErrOutsideGoPath, pkg, goDir, nil,
+			"Package %s (%s) not part of path (%s)", pkg, nativePkg, goDir)
 	}
+	srcPath := strings.TrimSuffix(goDir, nativePkg)
 
-	var rootPkg string
-	if c.flags.Checked(RecurseTopLevel) {
-		gitTopLevel, err := c.gitTopLevel(goDir)
+	if !strings.HasPrefix(topLevel, srcPath) {
+		return "", "", c.fail(ErrOutsideGoPath, pkg, goDir, nil,
+			"Top level (%s) of package %s, not below src (%s)", topLevel, pkg, srcPath)
+	}
+
+	return filepath.ToSlash(strings.TrimPrefix(topLevel, srcPath)), topLevel, nil
+}
+
+//repoRoots maps the root package of every repository visited so far to its
+//directory.
+func (c *Context) repoRoots() (map[string]string, error) {
+	roots := map[string]string{}
+	for pkg, goDir := range c.visited.Copy() {
+		rootPkg, rootDir, err := c.repoRootPkg(pkg, goDir)
 		if err != nil {
-			return true, c.errorf("%s", err.Error())
+			return nil, err
 		}
+		roots[rootPkg] = rootDir
+	}
+	return roots, nil
+}
 
-		nativePkg := filepath.FromSlash(pkg)
+func (c *Context) inspect(workingDir, pkg, goDir string, chain []string, depsOnly, tests bool) (bool, error) {
+	//never inspect twice
+	c.doneGo.Add(pkg)
 
-		if !strings.HasSuffix(goDir, nativePkg) {
-			return true, c.errorf("Package %s (%s) not part of path (%s)", pkg, nativePkg, goDir)
-		}
-		srcPath := strings.TrimSuffix(goDir, nativePkg)
+	vcs, isRepo := c.repoVCS(goDir)
+	if !isRepo {
+		return true, c.fail(ErrNotRepository, pkg, goDir, nil, "Package %s (%s) is not in a repository", pkg, goDir)
+	}
 
-		if !strings.HasPrefix(gitTopLevel, srcPath) {
-			return true, c.errorf("Git top level (%s) of package %s, not below src (%s)",
-				gitTopLevel, pkg, srcPath)
+	var rootPkg string
+	if c.flags.Checked(RecurseTopLevel) {
+		var err error
+		rootPkg, _, err = c.repoRootPkg(pkg, goDir)
+		if err != nil {
+			return true, err
 		}
-
-		rootPkg = filepath.ToSlash(strings.TrimPrefix(gitTopLevel, srcPath))
 	} else {
 		rootPkg = pkg
 	}
 
 	if rootPkg != pkg {
-		if c.AlreadyDoneGo(rootPkg) {
+		if !c.doneGo.Claim(rootPkg) {
 			return false, nil
 		}
-		c.doneGo[rootPkg] = empty{}
 
 		//Costs an extra call out to git, but keeps the code way more managable
-		err := c.Get(workingDir, rootPkg, depsOnly, tests)
+		err := c.get(workingDir, rootPkg, chain, depsOnly, tests)
 		if err != nil {
 			return false, err
 		}
 		return false, nil
 	}
+	c.visited.Set(pkg, goDir)
 
-	//Updates are only done if possible. Not an error to fail.
-	if c.flags.Checked(Update) {
-		err := c.runHook(pkg, goDir, "get-before-update.sh")
-		if err != nil {
+	if c.flags.Checked(DryRun) {
+		return true, c.planInspect(pkg, goDir)
+	}
+
+	//Without RecurseTopLevel, packages from the same repository are inspected
+	//separately and may be on different workers
+	repoPkg := rootPkg
+	if !c.flags.Checked(RecurseTopLevel) {
+		var err error
+		if repoPkg, _, err = c.repoRootPkg(pkg, goDir); err != nil {
 			return true, err
-		} else if gitStatus, err := c.gitCtx.Status(goDir); err != nil {
-			return true, c.errorf("Failed to get git status for package %s (%s): %s",
-				pkg, goDir, err.Error())
-		} else if gitStatus != git.Clean {
-			c.warnf("Not updating package %s (%s), git status is %s",
-				pkg, goDir, gitStatus.String())
-		} else if err := c.gitCtx.Checkout(goDir, "master"); err != nil {
-			c.warnf("Not updating package %s (%s), Couldn't checkout master: %s",
-				pkg, goDir, err.Error())
-		} else if err := c.gitCtx.Pull(goDir); err != nil {
-			c.warnf("Not updating package %s (%s), Couldn't pull: %s",
-				pkg, goDir, err.Error())
-		} else if c.flags.Checked(TaggedOnly) {
-			err := c.goToMostRecentTag(pkg, goDir)
-			if err != nil {
-				return true, err
-			}
 		}
 	}
+	unlock := c.repoLocks.Lock(repoPkg)
+	defer unlock()
+
+	remote, _ := c.ruleSet.ruleRemote(pkg)
+	if err := c.checkOrigin(vcs, pkg, goDir, remote); err != nil {
+		return true, err
+	}
+	if !c.flags.Checked(Update) {
+		return true, c.settle(vcs, pkg, goDir, remote, chain, false, false)
+	}
+
+	//Updates are only done if possible. Not an error to fail.
+	c.workers.acquire()
+	defer c.workers.release()
+
+	fromCommit, _ := vcs.Head(goDir)
+	fromTag := exactTag(vcs, goDir)
+	updated := false
+	c.snapshot(vcs, pkg, goDir, false)
+
+	err := c.runHook(pkg, goDir, "get-before-update.sh")
+	if err != nil {
+		return true, err
+	} else if clean, status, err := vcs.Status(goDir); err != nil {
+		return true, c.errorf("Failed to get %s status for package %s (%s): %s",
+			vcs.Name(), pkg, goDir, err.Error())
+	} else if policy := c.updatePolicy(remote); !clean && !policy.stashes() {
+		c.warnf("Not updating package %s (%s), %s status is %s",
+			pkg, goDir, vcs.Name(), status)
+		c.skipped(pkg, goDir, SkipDirty)
+	} else if err := c.addUpstream(vcs, pkg, goDir, remote); err != nil {
+		return true, err
+	} else if !clean {
+		updated = c.stashAndUpdate(vcs, pkg, goDir, remote, policy)
+	} else {
+		updated = c.update(vcs, pkg, goDir, remote, policy)
+	}
+	if updated {
+		c.compareUpstream(vcs, pkg, goDir, remote)
+	}
+
+	err = c.settle(vcs, pkg, goDir, remote, chain, false, updated)
+	if err != nil {
+		return true, err
+	}
+
+	toCommit, _ := vcs.Head(goDir)
+	c.result(pkg, goDir, func(r *Result) {
+		r.FromCommit = fromCommit
+		r.FromTag = fromTag
+		r.ToCommit = toCommit
+	})
 
 	return true, nil
 }
 
+//updateBranch returns the branch an update pulls into, either the one the
+//rule pins or the default branch of the remote, along with the branch
+//currently checked out ("" if detached, or if the rule pins a branch and the
+//checkout should be switched to it regardless).
+func (c *Context) updateBranch(vcs VCS, goDir string, remote Remote) (string, string, error) {
+	if remote.Branch != "" {
+		return remote.Branch, "", nil
+	}
+	branch, err := vcs.DefaultBranch(goDir)
+	if err != nil {
+		return "", "", err
+	}
+	current, err := vcs.Branch(goDir)
+	return branch, current, err
+}
+
+//checkoutRef moves to a pinned tag or commit, fetching first if it isn't
+//known locally.
+func (c *Context) checkoutRef(vcs VCS, goDir, ref string) error {
+	if !vcs.HasCommit(goDir, ref) {
+		if err := vcs.Fetch(goDir); err != nil {
+			return err
+		}
+	}
+	return vcs.Checkout(goDir, ref)
+}
+
 func (c *Context) runHook(pkg, goDir, filename string) error {
 	if !c.flags.Checked(ApplyHooks) {
 		return nil
@@ -335,7 +553,8 @@ func (c *Context) runHook(pkg, goDir, filename string) error {
 
 	output, _, err := c.cmdCtx.Execf("cd %s; %s", pkg, dsutil.PosixPath(hookFile))
 	if err != nil {
-		return c.errorf("Failed to run hook script '%s' for package %s (%s): %s\n%s",
+		c.result(pkg, goDir, func(r *Result) { r.HookFailures = append(r.HookFailures, filename) })
+		return c.fail(ErrHook, pkg, goDir, err, "Failed to run hook script '%s' for package %s (%s): %s\n%s",
 			filename, pkg, goDir, err.Error(), output)
 	}
 
@@ -343,20 +562,60 @@ func (c *Context) runHook(pkg, goDir, filename string) error {
 }
 
 func (c *Context) Get(workingDir, pkg string, depsOnly, tests bool) error {
-	return c.getList(workingDir, pkg, pkg, depsOnly, tests)
+	defer c.finishResults()
+
+	if !c.flags.Checked(Transactional) || c.flags.Checked(DryRun) {
+		return c.getAndInstall(workingDir, pkg, depsOnly, tests)
+	}
+	return c.getInTransaction(workingDir, pkg, depsOnly, tests)
+}
+
+func (c *Context) getAndInstall(workingDir, pkg string, depsOnly, tests bool) error {
+	err := c.get(workingDir, pkg, []string{pkg}, depsOnly, tests)
+	if err == nil {
+		err = c.moveQueued(workingDir, tests)
+	}
+	if err != nil && !c.flags.Checked(KeepGoing) {
+		return err
+	} else if err != nil {
+		c.keepGoing(err, []string{pkg})
+	}
+
+	err = c.installPending(workingDir)
+	if err != nil && !c.flags.Checked(KeepGoing) {
+		return err
+	} else if err != nil {
+		c.keepGoing(err, []string{pkg})
+	}
+
+	return c.collectedErrors()
 }
 
-func (c *Context) getList(workingDir, pkg, listPkg string, depsOnly, tests bool) error {
+//get fetches pkg and its dependencies, chain is the list of imports that
+//led to it.
+func (c *Context) get(workingDir, pkg string, chain []string, depsOnly, tests bool) error {
+	return c.getList(workingDir, pkg, pkg, chain, depsOnly, tests)
+}
+
+func (c *Context) getList(workingDir, pkg, listPkg string, chain []string, depsOnly, tests bool) error {
 	goDir, alreadyExists := c.goCtx.Dir(workingDir, pkg)
-	c.doneGo[pkg] = empty{}
+	c.doneGo.Add(pkg)
 
-	if depsOnly && !alreadyExists {
+	if _, _, ok := c.ruleSet.Override(pkg); ok {
+		shouldContinue, err := c.linkOverride(workingDir, pkg, chain, depsOnly, tests)
+		if err != nil {
+			return err
+		} else if !shouldContinue {
+			return nil
+		}
+		goDir, _ = c.goCtx.Dir(workingDir, pkg)
+	} else if depsOnly && !alreadyExists {
 		return c.errorf("Can not get dependencies only for package %s, package does not exist", pkg)
 	} else if depsOnly {
 		//Can do nothing
 
 	} else if !alreadyExists {
-		shouldContinue, err := c.clone(workingDir, pkg, goDir, depsOnly, tests)
+		shouldContinue, err := c.clone(workingDir, pkg, goDir, chain, depsOnly, tests)
 		if err != nil {
 			return err
 		} else if !shouldContinue {
@@ -365,7 +624,7 @@ func (c *Context) getList(workingDir, pkg, listPkg string, depsOnly, tests bool)
 	} else if !c.flags.Checked(Update) && !c.flags.Checked(DeepScan) {
 		return nil
 	} else {
-		shouldContinue, err := c.inspect(workingDir, pkg, goDir, depsOnly, tests)
+		shouldContinue, err := c.inspect(workingDir, pkg, goDir, chain, depsOnly, tests)
 		if err != nil {
 			return err
 		} else if !shouldContinue {
@@ -373,16 +632,24 @@ func (c *Context) getList(workingDir, pkg, listPkg string, depsOnly, tests bool)
 		}
 	}
 
-	var listPkgStr = listPkg
-	if c.flags.Checked(RecurseTopLevel) {
-		listPkgStr = listPkg + "/..."
-	}
-	list, err := c.goCtx.List(workingDir, listPkgStr)
+	return c.listDeps(workingDir, pkg, listPkg, goDir, chain, tests)
+}
+
+//listDeps lists the packages in listPkg, adds them to the graph and fetches
+//their imports, then queues pkg to be installed.
+func (c *Context) listDeps(workingDir, pkg, listPkg, goDir string, chain []string, tests bool) error {
+	c.workers.acquire()
+	list, err := c.list(workingDir, listPkg)
+	c.workers.release()
 	if err != nil {
 		return err
 	}
 
-	for _, e := range list {
+	listed := []string{}
+	deps := []string{}
+	for importPath, e := range list {
+		listed = append(listed, importPath)
+
 		//Only check imports, because the recursive nature of this tool
 		//will get the transisitive dependencies.
 		var imports []interface{}
@@ -395,31 +662,179 @@ func (c *Context) getList(workingDir, pkg, listPkg string, depsOnly, tests bool)
 			testImports = testImportsInt.([]interface{})
 		}
 
+		node := &GraphNode{ImportPath: importPath}
 		for _, impInt := range imports {
 			imp := impInt.(string)
-
-			if !c.goCtx.IsStdLib(imp) && !c.AlreadyDoneGo(imp) {
-				err := c.Get(workingDir, imp, false, false)
-				if err != nil {
-					return err
-				}
+			if !c.goCtx.IsStdLib(imp) {
+				deps = append(deps, imp)
+				node.Imports = append(node.Imports, imp)
 			}
 		}
+
 		if tests {
 			for _, impInt := range testImports {
 				imp := impInt.(string)
-				if !c.goCtx.IsStdLib(imp) && !c.AlreadyDoneGo(imp) {
-					err := c.Get(workingDir, imp, false, false)
-					if err != nil {
-						return err
-					}
+				if !c.goCtx.IsStdLib(imp) {
+					deps = append(deps, imp)
+					node.TestImports = append(node.TestImports, imp)
+				}
+			}
+		}
+		c.graph.add(node)
+	}
+
+	err = c.getDeps(workingDir, chain, deps)
+	if err != nil {
+		return err
+	}
+
+	c.pendingMu.Lock()
+	c.pending = append(c.pending, pendingInstall{pkg: pkg, goDir: goDir, listed: listed, imports: deps})
+	c.pendingMu.Unlock()
+
+	return nil
+}
+
+//relist lists the packages of a settled repository again after it has been
+//moved to another version, fetching anything they now import.
+func (c *Context) relist(workingDir string, s *settledRepo, tests bool) error {
+	c.pendingMu.Lock()
+	kept := []pendingInstall{}
+	moved := []pendingInstall{}
+	for _, p := range c.pending {
+		if p.goDir == s.dir || strings.HasPrefix(p.goDir, s.dir+string(filepath.Separator)) {
+			moved = append(moved, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	c.pending = kept
+	c.pendingMu.Unlock()
+
+	for _, p := range moved {
+		if err := c.listDeps(workingDir, p.pkg, p.pkg, p.goDir, s.chain, tests); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//getDeps fetches each dependency not already claimed, using as many workers
+//as the pool allows. With KeepGoing, failures are collected rather than
+//returned.
+func (c *Context) getDeps(workingDir string, chain []string, deps []string) error {
+	getDep := func(imp string) error {
+		depChain := append(append([]string{}, chain...), imp)
+		err := c.get(workingDir, imp, depChain, false, false)
+		if err != nil && c.flags.Checked(KeepGoing) {
+			c.keepGoing(err, depChain)
+			return nil
+		}
+		return err
+	}
+
+	if c.workers.Size() == 1 {
+		for _, imp := range deps {
+			if c.doneGo.Claim(imp) {
+				err := getDep(imp)
+				if err != nil {
+					return err
 				}
 			}
 		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(deps))
+	for i, imp := range deps {
+		if !c.doneGo.Claim(imp) {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, imp string) {
+			defer wg.Done()
+			errs[i] = getDep(imp)
+		}(i, imp)
 	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//installPending runs the install hooks and installs everything fetched so
+//far, dependencies first.
+func (c *Context) installPending(workingDir string) error {
+	c.pendingMu.Lock()
+	pending := c.pending
+	c.pending = nil
+	c.pendingMu.Unlock()
+
+	//A package failing to install doesn't stop the rest being installed. It
+	//has already been warned about, so isn't reported again.
+	var installErr error
+	for _, p := range orderPending(pending) {
+		if c.flags.Checked(DryRun) {
+			c.planInstall(p)
+			continue
+		}
+		err := c.install(workingDir, p)
+		if err == nil {
+			err = c.installErr(p.pkg)
+		}
+		if err != nil && c.flags.Checked(KeepGoing) {
+			c.keepGoing(err, []string{p.pkg})
+		} else if err != nil && !errors.Is(err, ErrInstall) {
+			return err
+		} else if err != nil && installErr == nil {
+			installErr = err
+		}
+	}
+	return installErr
+}
+
+//orderPending sorts pending installs so that each comes after the packages
+//it imports. Fetching in parallel can complete them in any order.
+func orderPending(pending []pendingInstall) []pendingInstall {
+	owner := map[string]int{}
+	for i, p := range pending {
+		for _, importPath := range p.listed {
+			owner[importPath] = i
+		}
+	}
+
+	ordered := []pendingInstall{}
+	seen := map[int]bool{}
+	var visit func(i int)
+	visit = func(i int) {
+		if seen[i] {
+			return
+		}
+		seen[i] = true
+		for _, imp := range pending[i].imports {
+			if j, ok := owner[imp]; ok {
+				visit(j)
+			}
+		}
+		ordered = append(ordered, pending[i])
+	}
+
+	for i := range pending {
+		visit(i)
+	}
+	return ordered
+}
+
+func (c *Context) install(workingDir string, p pendingInstall) error {
+	pkg, goDir := p.pkg, p.goDir
 
 	//Before install hook runs even if the install flag hasn't been set
-	err = c.runHook(pkg, goDir, "get-before-install.sh")
+	err := c.runHook(pkg, goDir, "get-before-install.sh")
 	if err != nil {
 		return err
 	}
@@ -428,18 +843,23 @@ func (c *Context) getList(workingDir, pkg, listPkg string, depsOnly, tests bool)
 	if c.flags.Checked(Install) {
 		if !c.flags.Checked(RecurseTopLevel) {
 			err := c.goCtx.Install(workingDir, pkg)
+			installFailed := []string{}
 			if err != nil {
 				c.warnf("%s Failed", pkg)
+				installFailed = append(installFailed, pkg)
+				c.installFailed(pkg)
 			}
+			c.installResult(pkg, goDir, installFailed)
 		} else {
 			//attempt to install everything; takes advantage of multiple cores
 			//but will bomb out if some of the sub pkgs are particularly broken
 			//if that happens, attempt installing one by one instead
-			err := c.goCtx.Install(workingDir, pkg+"/...")
+			err := c.installAll(workingDir, pkg)
 			if err != nil {
-				for importPath, _ := range list {
+				for _, importPath := range p.listed {
 					err := c.goCtx.Install(workingDir, importPath)
 					if err != nil {
+						c.installFailed(importPath)
 						//TODO check this part works:
 						if strings.HasPrefix(importPath, pkg+"/") {
 							failed = append(failed, ".../"+strings.TrimPrefix(importPath, pkg+"/"))
@@ -450,6 +870,7 @@ func (c *Context) getList(workingDir, pkg, listPkg string, depsOnly, tests bool)
 				}
 				c.warnf("%s/... [Failed: %s]", pkg, strings.Join(failed, ", "))
 			}
+			c.installResult(pkg, goDir, failed)
 		}
 	}
 
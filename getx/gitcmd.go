@@ -0,0 +1,229 @@
+package getx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/desal/cmd"
+	"github.com/desal/dsutil"
+	"github.com/desal/git"
+)
+
+//The git VCS, mostly github.com/desal/git with the few operations it doesn't
+//provide run directly.
+
+type gitVCS struct {
+	git *git.Context
+	cmd *cmd.Context
+}
+
+func gitf(cmdCtx *cmd.Context, goDir, s string, a ...interface{}) (string, error) {
+	args := append([]interface{}{dsutil.PosixPath(goDir)}, a...)
+	output, _, err := cmdCtx.Execf("git -C %s "+s, args...)
+	return strings.TrimSpace(output), err
+}
+
+func (c *Context) gitf(goDir, s string, a ...interface{}) (string, error) {
+	return gitf(c.cmdCtx, goDir, s, a...)
+}
+
+func (g *gitVCS) Name() string { return "git" }
+
+func (g *gitVCS) IsRepo(dir string) bool { return g.git.IsGit(dir) }
+
+func (g *gitVCS) TopLevel(dir string) (string, error) { return g.git.TopLevel(dir) }
+
+//Clone also remembers the branch the clone ended up on as the default branch.
+func (g *gitVCS) Clone(dir, url string) error {
+	if err := g.git.Clone(dir, url); err != nil {
+		return err
+	}
+	if branch, _ := g.Branch(dir); branch != "" {
+		gitf(g.cmd, dir, "config getx.defaultBranch %s", branch)
+	}
+	return nil
+}
+
+func (g *gitVCS) Status(dir string) (bool, string, error) {
+	status, err := g.git.Status(dir)
+	return status == git.Clean, status.String(), err
+}
+
+//DefaultBranch is the branch remembered for the repository, or failing that
+//the HEAD of origin, which is then remembered.
+func (g *gitVCS) DefaultBranch(dir string) (string, error) {
+	if branch, _ := gitf(g.cmd, dir, "config --get getx.defaultBranch"); branch != "" {
+		return branch, nil
+	}
+
+	branch := g.KnownDefaultBranch(dir)
+	if branch == "" {
+		//Not set locally, ask origin. Output is "ref: refs/heads/main\tHEAD"
+		output, err := gitf(g.cmd, dir, "ls-remote --symref origin HEAD")
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(output, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && fields[0] == "ref:" && fields[2] == "HEAD" {
+				branch = strings.TrimPrefix(fields[1], "refs/heads/")
+			}
+		}
+	}
+	if branch == "" {
+		return "", errors.New("origin has no HEAD branch")
+	}
+
+	_, err := gitf(g.cmd, dir, "config getx.defaultBranch %s", branch)
+	return branch, err
+}
+
+//KnownDefaultBranch only reads the remembered branch and the local copy of
+//origin's HEAD.
+func (g *gitVCS) KnownDefaultBranch(dir string) string {
+	if branch, _ := gitf(g.cmd, dir, "config --get getx.defaultBranch"); branch != "" {
+		return branch
+	}
+	branch, _ := gitf(g.cmd, dir, "symbolic-ref -q --short refs/remotes/origin/HEAD")
+	return strings.TrimPrefix(branch, "origin/")
+}
+
+func (g *gitVCS) Branch(dir string) (string, error) {
+	branch, err := gitf(g.cmd, dir, "symbolic-ref -q --short HEAD || true")
+	return branch, err
+}
+
+func (g *gitVCS) Checkout(dir, rev string) error { return g.git.Checkout(dir, rev) }
+
+func (g *gitVCS) Pull(dir string) error { return g.git.Pull(dir) }
+
+func (g *gitVCS) Fetch(dir string) error {
+	_, err := gitf(g.cmd, dir, "fetch -q --tags origin")
+	return err
+}
+
+func (g *gitVCS) Head(dir string) (string, error) {
+	return gitf(g.cmd, dir, "rev-parse HEAD")
+}
+
+func (g *gitVCS) Tags(dir string) ([]string, error) { return g.git.Tags(dir) }
+
+func (g *gitVCS) AllTags(dir string) ([]string, error) {
+	output, err := gitf(g.cmd, dir, "tag -l")
+	return strings.Fields(output), err
+}
+
+func (g *gitVCS) HasCommit(dir, commit string) bool {
+	_, err := gitf(g.cmd, dir, "cat-file -e %s^{commit} 2>/dev/null", commit)
+	return err == nil
+}
+
+func (g *gitVCS) Origin(dir string) (string, error) {
+	return gitf(g.cmd, dir, "config --get remote.origin.url")
+}
+
+//SetOrigin keeps the old url by adding it as a new remote, rather than
+//renaming origin, so branches carry on tracking origin.
+func (g *gitVCS) SetOrigin(dir, url, keepAs string) error {
+	if keepAs != "" {
+		old, err := g.Origin(dir)
+		if err != nil {
+			return err
+		}
+		if err := g.SetRemote(dir, keepAs, old); err != nil {
+			return err
+		}
+	}
+	_, err := gitf(g.cmd, dir, "remote set-url origin %s", url)
+	return err
+}
+
+func (g *gitVCS) SetRemote(dir, name, url string) error {
+	_, err := gitf(g.cmd, dir, "remote add %s %s 2>/dev/null || git -C %s remote set-url %s %s",
+		name, url, dsutil.PosixPath(dir), name, url)
+	return err
+}
+
+func (g *gitVCS) Behind(dir, remote, branch string) (int, error) {
+	if _, err := gitf(g.cmd, dir, "fetch -q %s", remote); err != nil {
+		return 0, err
+	}
+	output, err := gitf(g.cmd, dir, "rev-list --count HEAD..%s/%s", remote, branch)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(output)
+}
+
+func (g *gitVCS) RebaseOnto(dir, remote, branch string) error {
+	_, err := gitf(g.cmd, dir, "rebase -q %s/%s || { git -C %s rebase --abort; false; }",
+		remote, branch, dsutil.PosixPath(dir))
+	return err
+}
+
+//Rollback discards any changes first, including a conflicted merge.
+func (g *gitVCS) Rollback(dir, branch, commit string) error {
+	if _, err := gitf(g.cmd, dir, "reset -q --hard"); err != nil {
+		return err
+	}
+	if branch == "" {
+		return g.git.Checkout(dir, commit)
+	}
+	if err := g.git.Checkout(dir, branch); err != nil {
+		return err
+	}
+	_, err := gitf(g.cmd, dir, "reset -q --hard %s", commit)
+	return err
+}
+
+func (g *gitVCS) Commits(dir, from, to string) ([]string, error) {
+	output, err := gitf(g.cmd, dir, "rev-list --first-parent --reverse %s..%s", from, to)
+	if err != nil || output == "" {
+		return nil, err
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+func (g *gitVCS) FastForward(dir string) error {
+	_, err := gitf(g.cmd, dir, "pull -q --ff-only")
+	return err
+}
+
+func (g *gitVCS) Rebase(dir string) error {
+	_, err := gitf(g.cmd, dir, "pull -q --rebase || { git -C %s rebase --abort; false; }", dsutil.PosixPath(dir))
+	return err
+}
+
+func (g *gitVCS) Stash(dir string) (bool, error) {
+	before, _ := gitf(g.cmd, dir, "rev-parse -q --verify refs/stash || true")
+	if _, err := gitf(g.cmd, dir, "stash push -q -m go-getx"); err != nil {
+		return false, err
+	}
+	after, _ := gitf(g.cmd, dir, "rev-parse -q --verify refs/stash || true")
+	return before != after, nil
+}
+
+func (g *gitVCS) Unstash(dir string) error {
+	_, err := gitf(g.cmd, dir, "stash pop -q")
+	return err
+}
+
+func (g *gitVCS) AheadBehind(dir string) (int, int, error) {
+	output, err := gitf(g.cmd, dir, "rev-list --left-right --count HEAD...@{upstream} 2>/dev/null")
+	if err != nil {
+		return 0, 0, err
+	}
+	var ahead, behind int
+	_, err = fmt.Sscan(output, &ahead, &behind)
+	return ahead, behind, err
+}
+
+func (g *gitVCS) Log(dir, from, to string) ([]string, error) {
+	output, err := gitf(g.cmd, dir, "log --format='%%h %%s' %s..%s", from, to)
+	if err != nil || output == "" {
+		return nil, err
+	}
+	return strings.Split(output, "\n"), nil
+}
@@ -0,0 +1,178 @@
+package getx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//The import graph discovered while walking dependencies. Only non standard
+//library imports are recorded, and test imports only when tests were asked
+//for.
+
+type GraphNode struct {
+	ImportPath  string   `json:"importPath"`
+	Root        string   `json:"root"`
+	Imports     []string `json:"imports,omitempty"`
+	TestImports []string `json:"testImports,omitempty"` // Imported only by tests
+}
+
+type Graph struct {
+	Packages map[string]*GraphNode `json:"packages"`
+}
+
+type graph struct {
+	mu    sync.Mutex
+	nodes map[string]*GraphNode
+}
+
+func (g *graph) add(node *GraphNode) {
+	imports := stringSet{}
+	for _, imp := range node.Imports {
+		imports[imp] = empty{}
+	}
+	testOnly := []string{}
+	for _, imp := range node.TestImports {
+		if _, ok := imports[imp]; !ok {
+			testOnly = append(testOnly, imp)
+		}
+	}
+	node.TestImports = testOnly
+	if len(node.TestImports) == 0 {
+		node.TestImports = nil
+	}
+
+	sort.Strings(node.Imports)
+	sort.Strings(node.TestImports)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.nodes[node.ImportPath] = node
+}
+
+//Graph returns every package listed so far, each attributed to the root
+//package of the repository it was found in.
+func (c *Context) Graph() (Graph, error) {
+	roots, err := c.repoRoots()
+	if err != nil {
+		return Graph{}, err
+	}
+	//Overrides are linked rather than visited, and their working copy's top
+	//level is outside GOPATH
+	for root, dir := range c.ruleSet.Overrides {
+		roots[root] = dir
+	}
+
+	c.graph.mu.Lock()
+	defer c.graph.mu.Unlock()
+
+	g := Graph{Packages: map[string]*GraphNode{}}
+	for importPath, node := range c.graph.nodes {
+		n := *node
+		for rootPkg, _ := range roots {
+			if pkgContains(rootPkg, importPath) && len(rootPkg) > len(n.Root) {
+				n.Root = rootPkg
+			}
+		}
+		if n.Root == "" {
+			n.Root = importPath
+		}
+		g.Packages[importPath] = &n
+	}
+	return g, nil
+}
+
+func (g Graph) sortedPackages() []string {
+	pkgs := []string{}
+	for importPath, _ := range g.Packages {
+		pkgs = append(pkgs, importPath)
+	}
+	sort.Strings(pkgs)
+	return pkgs
+}
+
+func (g Graph) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(g, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+//WriteDot writes the graph in Graphviz format, with one cluster per
+//repository. Test only edges are dashed.
+func (g Graph) WriteDot(w io.Writer) error {
+	repos := map[string][]string{}
+	for _, importPath := range g.sortedPackages() {
+		root := g.Packages[importPath].Root
+		repos[root] = append(repos[root], importPath)
+	}
+	rootPkgs := []string{}
+	for root, _ := range repos {
+		rootPkgs = append(rootPkgs, root)
+	}
+	sort.Strings(rootPkgs)
+
+	fmt.Fprintln(w, "digraph imports {")
+	for i, root := range rootPkgs {
+		fmt.Fprintf(w, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(w, "\t\tlabel=%q;\n", root)
+		for _, importPath := range repos[root] {
+			fmt.Fprintf(w, "\t\t%q;\n", importPath)
+		}
+		fmt.Fprintln(w, "\t}")
+	}
+	for _, importPath := range g.sortedPackages() {
+		node := g.Packages[importPath]
+		for _, imp := range node.Imports {
+			fmt.Fprintf(w, "\t%q -> %q;\n", importPath, imp)
+		}
+		for _, imp := range node.TestImports {
+			fmt.Fprintf(w, "\t%q -> %q [style=dashed];\n", importPath, imp)
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+//WriteTree writes the imports of each of pkgs as an indented tree. Packages
+//already shown are marked with (*) rather than expanded again.
+func (g Graph) WriteTree(w io.Writer, pkgs ...string) error {
+	seen := stringSet{}
+	var write func(importPath, suffix string, depth int) error
+	write = func(importPath, suffix string, depth int) error {
+		node, listed := g.Packages[importPath]
+		_, alreadySeen := seen[importPath]
+		if alreadySeen && listed && (len(node.Imports) > 0 || len(node.TestImports) > 0) {
+			suffix += " (*)"
+		}
+		_, err := fmt.Fprintf(w, "%s%s%s\n", strings.Repeat("  ", depth), importPath, suffix)
+		if err != nil || alreadySeen || !listed {
+			return err
+		}
+		seen[importPath] = empty{}
+
+		for _, imp := range node.Imports {
+			if err := write(imp, "", depth+1); err != nil {
+				return err
+			}
+		}
+		for _, imp := range node.TestImports {
+			if err := write(imp, " [test]", depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, pkg := range pkgs {
+		if err := write(pkg, "", 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package getx
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraph(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u1/p1/s1", "gh/u2/p1/s1"),
+		Pkg("gh/u1/p1/s1", "gh/u2/p1/s1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1/s1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		ctx.Get(".", "gh/u1/p1", false, false)
+
+		g, err := ctx.Graph()
+		assert.Nil(t, err)
+		assert.Equal(t, Graph{Packages: map[string]*GraphNode{
+			"gh/u1/p1": {
+				ImportPath: "gh/u1/p1",
+				Root:       "gh/u1/p1",
+				Imports:    []string{"gh/u1/p1/s1", "gh/u2/p1/s1"},
+			},
+			"gh/u1/p1/s1": {
+				ImportPath: "gh/u1/p1/s1",
+				Root:       "gh/u1/p1",
+				Imports:    []string{"gh/u2/p1/s1"},
+			},
+			"gh/u2/p1/s1": {
+				ImportPath: "gh/u2/p1/s1",
+				Root:       "gh/u2/p1",
+			},
+		}}, g)
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, g.WriteTree(buf, "gh/u1/p1"))
+		assert.Equal(t, `gh/u1/p1
+  gh/u1/p1/s1
+    gh/u2/p1/s1
+  gh/u2/p1/s1
+`, buf.String())
+
+		buf.Reset()
+		assert.Nil(t, g.WriteDot(buf))
+		assert.Equal(t, `digraph imports {
+	subgraph cluster_0 {
+		label="gh/u1/p1";
+		"gh/u1/p1";
+		"gh/u1/p1/s1";
+	}
+	subgraph cluster_1 {
+		label="gh/u2/p1";
+		"gh/u2/p1/s1";
+	}
+	"gh/u1/p1" -> "gh/u1/p1/s1";
+	"gh/u1/p1" -> "gh/u2/p1/s1";
+	"gh/u1/p1/s1" -> "gh/u2/p1/s1";
+}
+`, buf.String())
+	})
+}
@@ -0,0 +1,258 @@
+package getx
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/desal/cmd"
+	"github.com/desal/dsutil"
+)
+
+//The Mercurial VCS.
+
+type hgVCS struct {
+	cmd *cmd.Context
+}
+
+func (h *hgVCS) hgf(dir, s string, a ...interface{}) (string, error) {
+	args := append([]interface{}{dsutil.PosixPath(dir)}, a...)
+	output, _, err := h.cmd.Execf("hg --cwd %s "+s, args...)
+	return strings.TrimSpace(output), err
+}
+
+func (h *hgVCS) Name() string { return "hg" }
+
+func (h *hgVCS) IsRepo(dir string) bool {
+	_, err := h.hgf(dir, "root 2>/dev/null")
+	return err == nil
+}
+
+func (h *hgVCS) TopLevel(dir string) (string, error) { return h.hgf(dir, "root") }
+
+func (h *hgVCS) Clone(dir, url string) error {
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	_, _, err := h.cmd.Execf("hg clone -q %s %s", url, dsutil.PosixPath(dir))
+	return err
+}
+
+func (h *hgVCS) Status(dir string) (bool, string, error) {
+	output, err := h.hgf(dir, "status")
+	if err != nil {
+		return false, "", err
+	} else if output != "" {
+		return false, "Uncommitted", nil
+	}
+	return true, "Clean", nil
+}
+
+func (h *hgVCS) DefaultBranch(dir string) (string, error) { return "default", nil }
+
+func (h *hgVCS) KnownDefaultBranch(dir string) string { return "default" }
+
+func (h *hgVCS) Branch(dir string) (string, error) { return h.hgf(dir, "branch") }
+
+func (h *hgVCS) Checkout(dir, rev string) error {
+	_, err := h.hgf(dir, "update -q %s", rev)
+	return err
+}
+
+func (h *hgVCS) Pull(dir string) error {
+	_, err := h.hgf(dir, "pull -q -u")
+	return err
+}
+
+func (h *hgVCS) Fetch(dir string) error {
+	_, err := h.hgf(dir, "pull -q")
+	return err
+}
+
+func (h *hgVCS) Head(dir string) (string, error) {
+	return h.hgf(dir, "log -r . -T '{node}'")
+}
+
+func (h *hgVCS) Tags(dir string) ([]string, error) {
+	output, err := h.hgf(dir, "log -r . -T '{tags}'")
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, tag := range strings.Fields(output) {
+		if tag != "tip" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (h *hgVCS) AllTags(dir string) ([]string, error) {
+	output, err := h.hgf(dir, "tags -q")
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, tag := range strings.Fields(output) {
+		if tag != "tip" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+func (h *hgVCS) HasCommit(dir, commit string) bool {
+	_, err := h.hgf(dir, "log -r %s -T . 2>/dev/null", commit)
+	return err == nil
+}
+
+func (h *hgVCS) Origin(dir string) (string, error) {
+	return h.hgf(dir, "paths default")
+}
+
+func (h *hgVCS) SetOrigin(dir, url, keepAs string) error {
+	if keepAs != "" {
+		old, err := h.Origin(dir)
+		if err != nil {
+			return err
+		}
+		if err := setHgPath(dir, keepAs, old); err != nil {
+			return err
+		}
+	}
+	return setHgPath(dir, "default", url)
+}
+
+func (h *hgVCS) SetRemote(dir, name, url string) error {
+	return setHgPath(dir, name, url)
+}
+
+//Behind asks the remote without pulling, as pulled changesets would be
+//mixed in with the fork's. incoming exits 1 when there is nothing to pull.
+func (h *hgVCS) Behind(dir, remote, branch string) (int, error) {
+	output, _, err := h.cmd.Execf(`hg --cwd %s incoming -q -b %s -T "x" %s; [ $? -le 1 ]`,
+		dsutil.PosixPath(dir), branch, remote)
+	if err != nil {
+		return 0, err
+	}
+	return len(strings.TrimSpace(output)), nil
+}
+
+func (h *hgVCS) RebaseOnto(dir, remote, branch string) error {
+	return errors.New("rebasing onto another repository isn't supported for hg")
+}
+
+//setHgPath sets a [paths] entry in the repository's hgrc, as hg has no
+//command to.
+func setHgPath(dir, name, url string) error {
+	hgrc := filepath.Join(dir, ".hg", "hgrc")
+	b, err := ioutil.ReadFile(hgrc)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entry := name + " = " + url
+	lines := []string{}
+	section, done := "", false
+	for _, line := range strings.Split(strings.TrimRight(string(b), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if section == "paths" && !done {
+				//Before the blank lines ending the section
+				i := len(lines)
+				for i > 0 && strings.TrimSpace(lines[i-1]) == "" {
+					i--
+				}
+				lines = append(lines[:i], append([]string{entry}, lines[i:]...)...)
+				done = true
+			}
+			section = strings.Trim(trimmed, "[]")
+		} else if kv := strings.SplitN(trimmed, "=", 2); section == "paths" && len(kv) == 2 && strings.TrimSpace(kv[0]) == name {
+			if !done {
+				lines, done = append(lines, entry), true
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if section == "paths" && !done {
+		lines, done = append(lines, entry), true
+	}
+	if !done {
+		lines = append(lines, "[paths]", entry)
+	}
+	return ioutil.WriteFile(hgrc, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+//Rollback only moves the working copy, as a pull doesn't move any branch.
+func (h *hgVCS) Rollback(dir, branch, commit string) error {
+	_, err := h.hgf(dir, "update -q -C %s", commit)
+	return err
+}
+
+//Commits includes both sides of merges, in revision order.
+func (h *hgVCS) Commits(dir, from, to string) ([]string, error) {
+	output, err := h.hgf(dir, `log -r "sort(only(%s, %s), rev)" -T "{node}\n"`, to, from)
+	if err != nil || output == "" {
+		return nil, err
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+//FastForward pulls, but only updates if that left the branch with one head.
+//Local changesets mean a second head, hg has no --ff-only.
+func (h *hgVCS) FastForward(dir string) error {
+	if _, err := h.hgf(dir, "pull -q"); err != nil {
+		return err
+	}
+	heads, err := h.hgf(dir, `heads -T "x" .`)
+	if err != nil {
+		return err
+	} else if len(heads) > 1 {
+		return errors.New("local changesets have diverged from the pulled ones")
+	}
+	_, err = h.hgf(dir, "update -q --check")
+	return err
+}
+
+func (h *hgVCS) Rebase(dir string) error {
+	_, err := h.hgf(dir, "--config extensions.rebase= pull -q --rebase || { hg --cwd %s --config extensions.rebase= rebase --abort; false; }",
+		dsutil.PosixPath(dir))
+	return err
+}
+
+//Stash uses a shelve named go-getx, so as not to touch the user's own.
+func (h *hgVCS) Stash(dir string) (bool, error) {
+	if output, err := h.hgf(dir, "status -mard"); err != nil || output == "" {
+		return false, err
+	}
+	_, err := h.hgf(dir, "--config extensions.shelve= shelve -q --name go-getx")
+	return err == nil, err
+}
+
+func (h *hgVCS) Unstash(dir string) error {
+	_, err := h.hgf(dir, "--config extensions.shelve= unshelve -q --name go-getx || { hg --cwd %s --config extensions.shelve= unshelve --abort; false; }",
+		dsutil.PosixPath(dir))
+	return err
+}
+
+//AheadBehind counts draft changesets as local, and later changesets on the
+//same branch as upstream.
+func (h *hgVCS) AheadBehind(dir string) (int, int, error) {
+	ahead, err := h.hgf(dir, `log -r "draft() and ::." -T "x"`)
+	if err != nil {
+		return 0, 0, err
+	}
+	behind, err := h.hgf(dir, `log -r "descendants(.) and branch(.) and not ." -T "x"`)
+	return len(ahead), len(behind), err
+}
+
+func (h *hgVCS) Log(dir, from, to string) ([]string, error) {
+	output, err := h.hgf(dir, `log -r "only(%s, %s)" -T "{node|short} {desc|firstline}\n"`, to, from)
+	if err != nil || output == "" {
+		return nil, err
+	}
+	return strings.Split(output, "\n"), nil
+}
@@ -0,0 +1,156 @@
+package getx
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+)
+
+//A lockfile records the exact commit each repository was left on, so that
+//the same tree can be reproduced later with Restore.
+
+type LockEntry struct {
+	Pkg    string `json:"pkg"`
+	Url    string `json:"url"`
+	Commit string `json:"commit"`
+	Tag    string `json:"tag,omitempty"`
+	VCS    string `json:"vcs,omitempty"` // Empty for git
+}
+
+type Lock struct {
+	Repos []LockEntry `json:"repos"`
+}
+
+func (l Lock) Entry(pkg string) (LockEntry, bool) {
+	for _, e := range l.Repos {
+		if e.Pkg == pkg {
+			return e, true
+		}
+	}
+	return LockEntry{}, false
+}
+
+//Lock records every repository visited by Get so far. Repositories already in
+//GOPATH that Get didn't need to clone or inspect are left out.
+func (c *Context) Lock() (Lock, error) {
+	roots, err := c.repoRoots()
+	if err != nil {
+		return Lock{}, err
+	}
+
+	lock := Lock{Repos: []LockEntry{}}
+	for rootPkg, rootDir := range roots {
+		vcs, isRepo := c.repoVCS(rootDir)
+		if !isRepo {
+			return Lock{}, c.fail(ErrNotRepository, rootPkg, rootDir, nil,
+				"Package %s (%s) is not in a repository", rootPkg, rootDir)
+		}
+		commit, err := vcs.Head(rootDir)
+		if err != nil {
+			return Lock{}, c.errorf("Failed to get commit for package %s (%s): %s",
+				rootPkg, rootDir, err.Error())
+		}
+
+		_, gitUrl, err := c.ruleSet.GetUrl(rootPkg)
+		if err != nil {
+			//Not fetched by a rule, fall back to wherever it was cloned from
+			gitUrl, err = vcs.Origin(rootDir)
+			if err != nil {
+				return Lock{}, c.errorf("No rule or origin for package %s (%s)", rootPkg, rootDir)
+			}
+		}
+
+		entry := LockEntry{
+			Pkg:    rootPkg,
+			Url:    gitUrl,
+			Commit: commit,
+			Tag:    exactTag(vcs, rootDir),
+		}
+		if vcs.Name() != "git" {
+			entry.VCS = vcs.Name()
+		}
+		lock.Repos = append(lock.Repos, entry)
+	}
+
+	sort.Slice(lock.Repos, func(i, j int) bool { return lock.Repos[i].Pkg < lock.Repos[j].Pkg })
+	return lock, nil
+}
+
+//Restore clones any missing repository in the lock and checks out the exact
+//commit recorded for each.
+func (c *Context) Restore(workingDir string, lock Lock) error {
+	for _, e := range lock.Repos {
+		goDir, alreadyExists := c.goCtx.Dir(workingDir, e.Pkg)
+
+		vcs, isRepo := c.repoVCS(goDir)
+		if !alreadyExists {
+			vcs = c.vcsNamed(e.VCS)
+			if err := vcs.Clone(goDir, e.Url); err != nil {
+				return c.fail(ErrClone, e.Pkg, goDir, err, "Failed to clone %s:\n%s", e.Url, err.Error())
+			}
+		} else if !isRepo {
+			return c.fail(ErrNotRepository, e.Pkg, goDir, nil, "Package %s (%s) is not in a repository", e.Pkg, goDir)
+		} else if clean, status, err := vcs.Status(goDir); err != nil {
+			return c.errorf("Failed to get %s status for package %s (%s): %s",
+				vcs.Name(), e.Pkg, goDir, err.Error())
+		} else if !clean {
+			return c.fail(ErrDirty, e.Pkg, goDir, nil, "Not restoring package %s (%s), %s status is %s",
+				e.Pkg, goDir, vcs.Name(), status)
+		}
+
+		if !vcs.HasCommit(goDir, e.Commit) {
+			if err := vcs.Fetch(goDir); err != nil {
+				return c.errorf("Failed to fetch package %s (%s): %s", e.Pkg, goDir, err.Error())
+			}
+		}
+
+		if err := vcs.Checkout(goDir, e.Commit); err != nil {
+			return c.errorf("Failed to checkout %s for package %s (%s): %s",
+				e.Commit, e.Pkg, goDir, err.Error())
+		}
+		c.visited.Set(e.Pkg, goDir)
+
+		if c.flags.Checked(Install) {
+			if err := c.goCtx.Install(workingDir, e.Pkg+"/..."); err != nil {
+				c.warnf("%s/... Failed", e.Pkg)
+				continue
+			}
+		}
+		c.verbosef("%s", e.Pkg)
+	}
+	return nil
+}
+
+func ReadLock(r io.Reader) (Lock, error) {
+	lock := Lock{}
+	err := json.NewDecoder(r).Decode(&lock)
+	return lock, err
+}
+
+func WriteLock(w io.Writer, lock Lock) error {
+	b, err := json.MarshalIndent(lock, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func LoadLockFromFile(filename string) (Lock, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return Lock{}, err
+	}
+	defer file.Close()
+	return ReadLock(file)
+}
+
+func SaveLockToFile(filename string, lock Lock) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return WriteLock(file, lock)
+}
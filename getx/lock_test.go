@@ -0,0 +1,59 @@
+package getx
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/cmd"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockRestore(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		ctx.Get(".", "gh/u1/p1", false, false)
+
+		lock, err := ctx.Lock()
+		assert.Nil(t, err)
+		if !assert.Len(t, lock.Repos, 2) {
+			return
+		}
+		assert.Equal(t, "gh/u1/p1", lock.Repos[0].Pkg)
+		assert.Equal(t, "gh/u2/p1", lock.Repos[1].Pkg)
+		for _, e := range lock.Repos {
+			_, gitUrl, _ := ruleSet.GetUrl(e.Pkg)
+			assert.Equal(t, gitUrl, e.Url)
+			assert.Len(t, e.Commit, 40)
+		}
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, WriteLock(buf, lock))
+		readLock, err := ReadLock(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, lock, readLock)
+
+		//Move one repo on, restore should put it back
+		goDir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		cmdCtx := cmd.New(goDir, format, cmd.Warn)
+		_, _, err = cmdCtx.Execf(`git commit -q --allow-empty -m "moved on"`)
+		assert.Nil(t, err)
+
+		restoreCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, restoreCtx.Restore(".", readLock))
+
+		head, err := restoreCtx.gitf(goDir, "rev-parse HEAD")
+		assert.Nil(t, err)
+		assert.Equal(t, lock.Repos[1].Commit, head)
+	})
+}
@@ -0,0 +1,328 @@
+package getx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//A repository can declare the versions it needs of other repositories in a
+//manifest at its root:
+//  # import root   constraint
+//  gh/u2/p1        ^1.2
+//  gh/u3/p1        >=2.1,<3
+//As repositories are cloned or updated their manifests are read, and each
+//required repository is moved to the lowest version tag satisfying every
+//requirement on it (minimal version selection). Requirements arriving after a
+//repository has been fetched move it again once everything has been fetched,
+//along with anything its own manifest then requires, and its packages are
+//listed again for any new imports. Repositories that weren't cloned or
+//updated are only checked, and a warning given if they don't satisfy their
+//requirements. Those updated are only moved on from the version the update
+//reached. Rule pins (#branch, @ref) always win over manifests, with a warning
+//if they don't satisfy them.
+
+const ManifestFilename = ".go-getx-deps"
+
+type Requirement struct {
+	Root       string // Import path of the required repository
+	Constraint Constraint
+}
+
+//ReadManifest parses a manifest, filename is only used in errors.
+func ReadManifest(r io.Reader, filename string) ([]Requirement, error) {
+	reqs := []Requirement{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected import root and constraint: %q", filename, lineNo, scanner.Text())
+		}
+		constraint, err := ParseConstraint(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", filename, lineNo, err.Error())
+		}
+		reqs = append(reqs, Requirement{fields[0], constraint})
+	}
+	return reqs, scanner.Err()
+}
+
+//LoadManifest reads the manifest in the repository at dir, if it has one.
+func LoadManifest(dir string) ([]Requirement, error) {
+	filename := filepath.Join(dir, ManifestFilename)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadManifest(file, filename)
+}
+
+//A requirement found in the manifest of the repository by.
+type requirement struct {
+	constraint Constraint
+	by         string
+	chain      []string // Imports that led to by
+}
+
+func (r requirement) String() string {
+	return fmt.Sprintf("%s required by %s (%s)", r.constraint.String(), r.by, strings.Join(r.chain, " -> "))
+}
+
+//A repository that has been cloned or inspected, whose version is settled
+//unless a new requirement moves it.
+type settledRepo struct {
+	vcs     VCS
+	dir     string
+	remote  Remote
+	chain   []string
+	cloned  bool
+	updated bool // Only moved to versions after the one updated to
+}
+
+//movable is true for repositories this Get changed, which may be moved to
+//another version.
+func (s *settledRepo) movable() bool { return s.cloned || s.updated }
+
+type requirements struct {
+	mu      sync.Mutex
+	reqs    map[string][]requirement // Keyed by required root
+	settled map[string]*settledRepo
+	queued  []string // Settled roots whose requirements changed, to be moved
+}
+
+//settle records that a repository has been fetched, moves it to the version
+//its requirements (or rule) ask for, then applies its own manifest. The
+//caller either holds the repository's lock, or is the only one to touch it.
+func (c *Context) settle(vcs VCS, rootPkg, goDir string, remote Remote, chain []string, cloned, updated bool) error {
+	s := &settledRepo{vcs, goDir, remote, chain, cloned, updated}
+	c.requirements.mu.Lock()
+	c.requirements.settled[rootPkg] = s
+	c.requirements.mu.Unlock()
+
+	if err := c.selectVersion(rootPkg, s, true); err != nil {
+		return err
+	}
+	return c.applyManifest(rootPkg, s)
+}
+
+//selectVersion checks out the version for a settled repository. Without any
+//requirements on it, tag selection is left to the TaggedOnly flag and version
+//constraints, and only done the first time.
+func (c *Context) selectVersion(rootPkg string, s *settledRepo, first bool) error {
+	c.requirements.mu.Lock()
+	reqs := append([]requirement{}, c.requirements.reqs[rootPkg]...)
+	c.requirements.mu.Unlock()
+
+	if len(reqs) == 0 {
+		if first && s.movable() && !s.remote.Pinned() && c.tagged(s.remote) {
+			return c.goToHighestTag(s.vcs, rootPkg, s.dir, s.remote)
+		}
+		return nil
+	}
+
+	constraints := []Constraint{}
+	for _, r := range reqs {
+		constraints = append(constraints, r.constraint)
+	}
+	if s.remote.Constraint != "" {
+		ruleConstraint, err := ParseConstraint(s.remote.Constraint)
+		if err != nil {
+			return c.errorf("Package %s (%s): %s", rootPkg, s.dir, err.Error())
+		}
+		constraints = append(constraints, ruleConstraint)
+	}
+
+	tags, err := s.vcs.Tags(s.dir)
+	if err != nil {
+		return c.errorf("Failed to get %s tags for package %s (%s): %s",
+			s.vcs.Name(), rootPkg, s.dir, err.Error())
+	}
+
+	satisfied := false
+	var current *Version
+	for _, tag := range tags {
+		if v, ok := ParseVersion(tag); ok {
+			satisfied = satisfied || satisfiesAll(v, constraints)
+			if current == nil || v.Compare(*current) > 0 {
+				current = &v
+			}
+		}
+	}
+	if s.remote.Pinned() {
+		if !satisfied {
+			c.warnf("Package %s (%s) is pinned to %s by its rule, which doesn't satisfy %s",
+				rootPkg, s.dir, s.remote.pin(), joinRequirements(reqs, ", "))
+		}
+		return nil
+	} else if !s.movable() || (s.updated && satisfied) {
+		if !satisfied {
+			c.warnf("Package %s (%s) is not at a version satisfying %s", rootPkg, s.dir, joinRequirements(reqs, ", "))
+		}
+		return nil
+	}
+
+	allTags, err := s.vcs.AllTags(s.dir)
+	if err != nil {
+		return c.errorf("Failed to get %s tags for package %s (%s): %s",
+			s.vcs.Name(), rootPkg, s.dir, err.Error())
+	}
+
+	versions := satisfying(allTags, constraints, c.flags.Checked(Prerelease))
+	if len(versions) == 0 {
+		return c.fail(ErrConflict, rootPkg, s.dir, nil, "No version of %s satisfies every requirement:\n  %s",
+			rootPkg, joinRequirements(reqs, "\n  "))
+	}
+	if s.updated {
+		//Don't undo the update, only move on from it
+		for len(versions) > 0 && (current == nil || versions[0].Compare(*current) < 0) {
+			versions = versions[1:]
+		}
+		if len(versions) == 0 {
+			c.warnf("Package %s (%s) was updated past every version satisfying %s",
+				rootPkg, s.dir, joinRequirements(reqs, ", "))
+			return nil
+		}
+	}
+	v := versions[0]
+	if stringInSlice(tags, v.Tag) {
+		return nil
+	}
+
+	c.verbosef("%s: selected %s for %s", rootPkg, v.Tag, joinRequirements(reqs, ", "))
+	if err := s.vcs.Checkout(s.dir, v.Tag); err != nil {
+		return c.errorf("Failed to checkout tag %s for package %s (%s): %s",
+			v.Tag, rootPkg, s.dir, err.Error())
+	}
+	return nil
+}
+
+func satisfiesAll(v Version, constraints []Constraint) bool {
+	for _, c := range constraints {
+		if !c.Check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func joinRequirements(reqs []requirement, sep string) string {
+	lines := []string{}
+	for _, r := range reqs {
+		lines = append(lines, r.String())
+	}
+	return strings.Join(lines, sep)
+}
+
+//applyManifest replaces the requirements from rootPkg with those in its
+//manifest, and queues any settled repository they apply to to be moved.
+func (c *Context) applyManifest(rootPkg string, s *settledRepo) error {
+	manifest, err := LoadManifest(s.dir)
+	if err != nil {
+		return c.errorf("Failed to read manifest for package %s (%s): %s", rootPkg, s.dir, err.Error())
+	}
+
+	c.requirements.mu.Lock()
+	defer c.requirements.mu.Unlock()
+
+	//Dropped requirements may let a repository move too
+	changed := stringSet{}
+	for root, reqs := range c.requirements.reqs {
+		kept := []requirement{}
+		for _, r := range reqs {
+			if r.by != rootPkg {
+				kept = append(kept, r)
+			} else {
+				changed[root] = empty{}
+			}
+		}
+		c.requirements.reqs[root] = kept
+	}
+
+	for _, r := range manifest {
+		c.requirements.reqs[r.Root] = append(c.requirements.reqs[r.Root], requirement{r.Constraint, rootPkg, s.chain})
+		changed[r.Root] = empty{}
+	}
+
+	roots := []string{}
+	for root, _ := range changed {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	for _, root := range roots {
+		if _, ok := c.requirements.settled[root]; !ok || root == rootPkg {
+			//Not fetched yet, the requirements apply when it is
+			continue
+		} else if !stringInSlice(c.requirements.queued, root) {
+			c.requirements.queued = append(c.requirements.queued, root)
+		}
+	}
+	return nil
+}
+
+//moveQueued moves each settled repository whose requirements changed after
+//it was fetched, once nothing else is being fetched. A repository that moves
+//has its manifest applied again, and its packages listed again, since they
+//may now import something else.
+func (c *Context) moveQueued(workingDir string, tests bool) error {
+	moves := map[string]int{}
+	for {
+		c.requirements.mu.Lock()
+		if len(c.requirements.queued) == 0 {
+			c.requirements.mu.Unlock()
+			return nil
+		}
+		root := c.requirements.queued[0]
+		c.requirements.queued = c.requirements.queued[1:]
+		s := c.requirements.settled[root]
+		c.requirements.mu.Unlock()
+
+		moves[root]++
+		if moves[root] > 100 {
+			return c.fail(ErrConflict, root, s.dir, nil,
+				"Requirements on %s keep changing, giving up", root)
+		}
+		moved, err := c.moveSettled(root, s)
+		if err != nil {
+			return err
+		} else if !moved {
+			continue
+		}
+		if err := c.applyManifest(root, s); err != nil {
+			return err
+		} else if err := c.relist(workingDir, s, tests); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Context) moveSettled(root string, s *settledRepo) (bool, error) {
+	unlock := c.repoLocks.Lock(root)
+	defer unlock()
+
+	before, _ := s.vcs.Head(s.dir)
+	if err := c.selectVersion(root, s, false); err != nil {
+		return false, err
+	}
+	after, _ := s.vcs.Head(s.dir)
+	if after == before {
+		return false, nil
+	}
+	c.result(root, s.dir, func(r *Result) { r.ToCommit = after })
+	return true, nil
+}
@@ -0,0 +1,125 @@
+package getx
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/desal/dsutil"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadManifest(t *testing.T) {
+	reqs, err := ReadManifest(strings.NewReader(`# import root   constraint
+gh/u2/p1 ^1.2
+
+gh/u3/p1 >=2.1,<3 # not 3 yet
+`), "deps")
+	if assert.Nil(t, err) && assert.Len(t, reqs, 2) {
+		assert.Equal(t, "gh/u2/p1", reqs[0].Root)
+		assert.Equal(t, ">=2.1,<3", reqs[1].Constraint.String())
+	}
+
+	_, err = ReadManifest(strings.NewReader("gh/u2/p1\n"), "deps")
+	assert.Contains(t, err.Error(), "deps:1:")
+	_, err = ReadManifest(strings.NewReader("\ngh/u2/p1 ^one\n"), "deps")
+	assert.Contains(t, err.Error(), "deps:2:")
+}
+
+func pushManifest(t *testing.T, format richtext.Format, url, manifest string) {
+	upstreamf(t, format, url,
+		"printf '"+manifest+"' > "+ManifestFilename,
+		"git add -A",
+		`git commit -q -m "deps"`,
+		"git push -q origin master")
+}
+
+func TestManifest(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1", "gh/u3/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+	repos.AddRepo("gh/u3/p1",
+		Pkg("gh/u3/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u4/p1",
+		Pkg("gh/u4/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		u1Url, u2Url, u3Url := ruleSet.Rules[0].Replace, ruleSet.Rules[1].Replace, ruleSet.Rules[2].Replace
+
+		commands := []string{}
+		for _, tag := range []string{"v1.0.0", "v1.1.0", "v1.2.0", "v2.0.0"} {
+			if tag == "v1.1.0" {
+				commands = append(commands, `printf 'package p1\nimport _ "gh/u4/p1"\n' > u4.go && git add u4.go`)
+			}
+			commands = append(commands, `git commit -q --allow-empty -m "`+tag+`"`, "git tag "+tag)
+		}
+		upstreamf(t, format, u2Url, append(commands, "git push -q --tags origin master")...)
+		pushManifest(t, format, u1Url, `gh/u2/p1 ^1.0\n`)
+		pushManifest(t, format, u3Url, `gh/u2/p1 >=1.1\n`)
+
+		u2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		tagCommit := func(ctx *Context, tag string) string {
+			commit, _ := ctx.gitf(u2Dir, "rev-parse %s^{commit}", tag)
+			return commit
+		}
+
+		//gh/u2/p1 is cloned at v1.0.0 for gh/u1/p1, then moved to v1.1.0 once
+		//gh/u3/p1 is reached, and listed again for its new import
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, tagCommit(ctx, "v1.1.0"), ctx.head(u2Dir))
+		assert.True(t, dsutil.CheckPath(filepath.Join(goPath[0], "src", "gh", "u4", "p1")))
+		for _, r := range ctx.Results() {
+			if r.Pkg == "gh/u2/p1" {
+				assert.Equal(t, tagCommit(ctx, "v1.1.0"), r.ToCommit)
+			}
+		}
+
+		pushManifest(t, format, u3Url, `gh/u2/p1 ^2\n`)
+
+		updateCtx := New(format, goPath, ruleSet, "", RecurseTopLevel, Update)
+		err := updateCtx.Get(".", "gh/u1/p1", false, false)
+		assert.True(t, errors.Is(err, ErrConflict))
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), "^1.0 required by gh/u1/p1 (gh/u1/p1)")
+			assert.Contains(t, err.Error(), "^2 required by gh/u3/p1 (gh/u1/p1 -> gh/u3/p1)")
+		}
+	})
+}
+
+func TestManifestUpdate(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		u1Url, u2Url := ruleSet.Rules[0].Replace, ruleSet.Rules[1].Replace
+		pushManifest(t, format, u1Url, `gh/u2/p1 ^1.0\n`)
+		upstreamf(t, format, u2Url,
+			`git commit -q --allow-empty -m "v1.0.0"`, "git tag v1.0.0",
+			"git push -q --tags origin master")
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+
+		//The update isn't undone by moving back to the lowest version
+		head := upstreamf(t, format, u2Url,
+			`git commit -q --allow-empty -m "v1.1.0"`, "git tag v1.1.0",
+			"git push -q --tags origin master")
+		updateCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update)
+		assert.Nil(t, updateCtx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, head, updateCtx.head(filepath.Join(goPath[0], "src", "gh", "u2", "p1")))
+	})
+}
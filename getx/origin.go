@@ -0,0 +1,39 @@
+package getx
+
+//Checkouts keep pulling from wherever they were cloned from, so when a rule
+//is changed to point a repository somewhere new, existing checkouts drift.
+//Every inspected repository's origin is compared with the url its rule gives,
+//and with the FixOrigin flag origin is pointed at the rule's url before
+//anything is pulled.
+
+//SetKeepOrigin makes FixOrigin keep the url origin had as a remote with this
+//name. The old url is dropped if name is "".
+func (c *Context) SetKeepOrigin(name string) {
+	c.keepOrigin = name
+}
+
+//checkOrigin warns if origin isn't the url the rule gives, and with
+//FixOrigin changes it.
+func (c *Context) checkOrigin(vcs VCS, pkg, goDir string, remote Remote) error {
+	if remote.Url == "" {
+		return nil
+	}
+	origin, err := vcs.Origin(goDir)
+	if err != nil || origin == remote.Url {
+		return nil
+	}
+
+	c.result(pkg, goDir, func(r *Result) { r.Origin = origin })
+	if !c.flags.Checked(FixOrigin) {
+		c.warnf("Package %s (%s) origin is %s, but the rules give %s", pkg, goDir, origin, remote.Url)
+		return nil
+	}
+
+	if err := vcs.SetOrigin(goDir, remote.Url, c.keepOrigin); err != nil {
+		return c.errorf("Failed to change origin of package %s (%s) to %s: %s",
+			pkg, goDir, remote.Url, err.Error())
+	}
+	c.verbosef("%s origin changed from %s to %s", pkg, origin, remote.Url)
+	c.result(pkg, goDir, func(r *Result) { r.OriginFixed = true })
+	return nil
+}
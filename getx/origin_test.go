@@ -0,0 +1,63 @@
+package getx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrigin(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+
+		p1Dir := filepath.Join(goPath[0], "src", "gh", "u1", "p1")
+		p1Url := ruleSet.Rules[0].Replace
+		oldUrl := filepath.Join(t.TempDir(), "moved.git")
+		_, err := ctx.gitf(p1Dir, "remote set-url origin %s", oldUrl)
+		assert.Nil(t, err)
+		head := upstreamf(t, format, p1Url, `git commit -q --allow-empty -m "moved"`, "git push -q origin master")
+
+		warnCtx := New(format, goPath, ruleSet, "", Warn, RecurseTopLevel, Update)
+		assert.Nil(t, warnCtx.Get(".", "gh/u1/p1", false, false))
+		results := warnCtx.Results()
+		assert.Equal(t, oldUrl, results[0].Origin)
+		assert.False(t, results[0].OriginFixed)
+		assert.Equal(t, []SkipReason{SkipPullFailed}, results[0].Skipped)
+
+		fixCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update, FixOrigin)
+		fixCtx.SetKeepOrigin("old")
+		assert.Nil(t, fixCtx.Get(".", "gh/u1/p1", false, false))
+		results = fixCtx.Results()
+		assert.True(t, results[0].OriginFixed)
+		assert.Equal(t, head, results[0].ToCommit)
+
+		origin, _ := fixCtx.gitf(p1Dir, "config --get remote.origin.url")
+		assert.Equal(t, p1Url, origin)
+		old, _ := fixCtx.gitf(p1Dir, "config --get remote.old.url")
+		assert.Equal(t, oldUrl, old)
+	})
+}
+
+func TestSetHgPath(t *testing.T) {
+	dir := t.TempDir()
+	hgrc := filepath.Join(dir, ".hg", "hgrc")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(hgrc), 0755))
+	assert.Nil(t, ioutil.WriteFile(hgrc, []byte("[paths]\ndefault = http://old/repo\n\n[ui]\nusername = me\n"), 0644))
+
+	assert.Nil(t, setHgPath(dir, "default", "http://new/repo"))
+	assert.Nil(t, setHgPath(dir, "old", "http://old/repo"))
+	b, _ := ioutil.ReadFile(hgrc)
+	assert.Equal(t, "[paths]\ndefault = http://new/repo\nold = http://old/repo\n\n[ui]\nusername = me\n", string(b))
+}
@@ -0,0 +1,161 @@
+package getx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//An override uses a working copy outside GOPATH for an import root, with an
+//"override <root> <dir>" line in a rules file or AddOverride. The working
+//copy is symlinked into GOPATH and never cloned or updated, but its imports
+//are still fetched. go list and go install don't follow symlinks for ...
+//patterns, so packages below an override are found by walking it.
+
+//AddOverride makes root use the working copy in dir, replacing any override
+//already given for root.
+func (r *RuleSet) AddOverride(root, dir string) error {
+	dir, err := filepath.Abs(expandHome(dir))
+	if err != nil {
+		return err
+	}
+	if r.Overrides == nil {
+		r.Overrides = map[string]string{}
+	}
+	r.Overrides[root] = dir
+	return nil
+}
+
+//Override returns the override for the import root containing pkg, if any.
+func (r *RuleSet) Override(pkg string) (root, dir string, ok bool) {
+	for overrideRoot, overrideDir := range r.Overrides {
+		if pkgContains(overrideRoot, pkg) && len(overrideRoot) > len(root) {
+			root, dir, ok = overrideRoot, overrideDir, true
+		}
+	}
+	return root, dir, ok
+}
+
+//addOverrides adds those overrides in from that aren't already given.
+func (r *RuleSet) addOverrides(from map[string]string) {
+	for root, dir := range from {
+		if _, ok := r.Overrides[root]; !ok {
+			if r.Overrides == nil {
+				r.Overrides = map[string]string{}
+			}
+			r.Overrides[root] = dir
+		}
+	}
+}
+
+//overrideDirective returns the root and directory of an
+//"override <root> <dir>" line, if text is one. Relative directories are
+//relative to the file the line is in.
+func overrideDirective(text, filename string) (string, string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) != 3 || fields[0] != "override" || strings.Contains(text, "=") {
+		return "", "", false
+	}
+	dir := expandHome(fields[2])
+	if !filepath.IsAbs(dir) && filename != "" {
+		dir = filepath.Join(filepath.Dir(filename), dir)
+	}
+	return fields[1], dir, true
+}
+
+//linkOverride symlinks the working copy for pkg's root into GOPATH, in place
+//of cloning or inspecting it.
+func (c *Context) linkOverride(workingDir, pkg string, chain []string, depsOnly, tests bool) (bool, error) {
+	root, dir, _ := c.ruleSet.Override(pkg)
+	if root != pkg && c.flags.Checked(RecurseTopLevel) {
+		if !c.doneGo.Claim(root) {
+			return false, nil
+		}
+		return false, c.get(workingDir, root, chain, depsOnly, tests)
+	}
+
+	rootDir, _ := c.goCtx.Dir(workingDir, root)
+	if c.flags.Checked(DryRun) {
+		c.planStep(root, rootDir, func(s *PlanStep) { s.Link = dir })
+	} else if target, err := os.Readlink(rootDir); err == nil && target == dir {
+		//Already linked
+	} else if _, err := os.Lstat(rootDir); err == nil {
+		return false, c.errorf("Can not link package %s to %s, %s already exists", root, dir, rootDir)
+	} else if err := os.MkdirAll(filepath.Dir(rootDir), 0755); err != nil {
+		return false, c.errorf("Failed to link package %s to %s: %s", root, dir, err.Error())
+	} else if err := os.Symlink(dir, rootDir); err != nil {
+		return false, c.errorf("Failed to link package %s to %s: %s", root, dir, err.Error())
+	} else {
+		c.verbosef("%s linked to %s", root, dir)
+	}
+	c.result(root, rootDir, func(r *Result) { r.Override = dir })
+
+	//Nothing to list until it's really linked
+	return !c.flags.Checked(DryRun), nil
+}
+
+//list runs go list on pkg, and with RecurseTopLevel on every package below
+//it.
+func (c *Context) list(workingDir, pkg string) (map[string]map[string]interface{}, error) {
+	if !c.flags.Checked(RecurseTopLevel) {
+		return c.goCtx.List(workingDir, pkg)
+	} else if _, _, ok := c.ruleSet.Override(pkg); !ok {
+		return c.goCtx.List(workingDir, pkg+"/...")
+	}
+
+	list := map[string]map[string]interface{}{}
+	for _, importPath := range c.overridePkgs(workingDir, pkg) {
+		listed, err := c.goCtx.List(workingDir, importPath)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range listed {
+			list[k] = v
+		}
+	}
+	return list, nil
+}
+
+//installAll installs pkg and every package below it.
+func (c *Context) installAll(workingDir, pkg string) error {
+	if _, _, ok := c.ruleSet.Override(pkg); !ok {
+		return c.goCtx.Install(workingDir, pkg+"/...")
+	}
+	for _, importPath := range c.overridePkgs(workingDir, pkg) {
+		if err := c.goCtx.Install(workingDir, importPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//overridePkgs finds the packages below pkg in an override, skipping the
+//directories ... would.
+func (c *Context) overridePkgs(workingDir, pkg string) []string {
+	goDir, _ := c.goCtx.Dir(workingDir, pkg)
+	dir, err := filepath.EvalSymlinks(goDir)
+	if err != nil {
+		return []string{pkg}
+	}
+
+	pkgs := []string{}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		name := info.Name()
+		if path != dir && (name == "testdata" || name == "vendor" ||
+			strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		if goFiles, _ := filepath.Glob(filepath.Join(path, "*.go")); len(goFiles) > 0 {
+			rel, _ := filepath.Rel(dir, path)
+			pkgs = append(pkgs, strings.TrimSuffix(pkg+"/"+filepath.ToSlash(rel), "/."))
+		}
+		return nil
+	})
+	if len(pkgs) == 0 {
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
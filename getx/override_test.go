@@ -0,0 +1,97 @@
+package getx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/desal/cmd"
+	"github.com/desal/dsutil"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverride(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+	repos.AddRepo("gh/u3/p1",
+		Pkg("gh/u3/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		workDir := filepath.Join(t.TempDir(), "p1")
+		_, _, err := cmd.New(".", format, cmd.Warn).Execf("git clone -q %s %s", ruleSet.Rules[1].Replace, workDir)
+		if !assert.Nil(t, err) {
+			return
+		}
+		extraDir := filepath.Join(workDir, "extra")
+		assert.Nil(t, os.MkdirAll(extraDir, 0755))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(extraDir, "extra.go"),
+			[]byte("package extra\n\nimport _ \"gh/u3/p1\"\n"), 0644))
+		assert.Nil(t, ruleSet.AddOverride("gh/u2/p1", workDir))
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Install)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+
+		p2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		target, err := os.Readlink(p2Dir)
+		assert.Nil(t, err)
+		assert.Equal(t, workDir, target)
+		assert.True(t, dsutil.CheckPath(filepath.Join(goPath[0], "src", "gh", "u3", "p1")))
+
+		results := map[string]Result{}
+		for _, r := range ctx.Results() {
+			results[r.Pkg] = r
+		}
+		assert.Equal(t, workDir, results["gh/u2/p1"].Override)
+		assert.False(t, results["gh/u2/p1"].Cloned)
+		assert.Nil(t, results["gh/u2/p1"].InstallFailed)
+
+		g, _ := ctx.Graph()
+		assert.Equal(t, []string{"gh/u3/p1"}, g.Packages["gh/u2/p1/extra"].Imports)
+		assert.Equal(t, "gh/u2/p1", g.Packages["gh/u2/p1/extra"].Root)
+		assert.Equal(t, "gh/u2/p1", g.Packages["gh/u2/p1"].Root)
+
+		statuses, err := ctx.Status(false, false)
+		assert.Nil(t, err)
+		linked := map[string]string{}
+		for _, s := range statuses {
+			linked[s.Pkg] = s.Override
+		}
+		if assert.Contains(t, linked, "gh/u2/p1") {
+			assert.Equal(t, workDir, linked["gh/u2/p1"])
+		}
+
+		head := ctx.head(workDir)
+		upstreamf(t, format, ruleSet.Rules[1].Replace, `git commit -q --allow-empty -m "new"`, "git push -q origin master")
+		updateCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update)
+		assert.Nil(t, updateCtx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, head, updateCtx.head(workDir))
+	})
+}
+
+func TestOverrideDirective(t *testing.T) {
+	ruleSet, err := loadRules(strings.NewReader(`a/([^/]+)=http://server/repos/$1.git
+override a/hats ../hats
+override a/shoes /work/shoes
+`), "/home/me/.go-getx-map", nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, ruleSet.Rules, 1)
+	assert.Equal(t, map[string]string{"a/hats": "/home/hats", "a/shoes": "/work/shoes"}, ruleSet.Overrides)
+
+	root, dir, ok := ruleSet.Override("a/hats/top")
+	assert.True(t, ok)
+	assert.Equal(t, "a/hats", root)
+	assert.Equal(t, "/home/hats", dir)
+	_, _, ok = ruleSet.Override("a/hatstand")
+	assert.False(t, ok)
+}
@@ -0,0 +1,79 @@
+package getx
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/desal/cmd"
+	"github.com/desal/dsutil"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+//upstreamf runs commands in a fresh clone of a rule's bare repository, so
+//tests can push branches, tags and commits to it.
+func upstreamf(t *testing.T, format richtext.Format, url string, commands ...string) string {
+	dir := filepath.Join(t.TempDir(), "upstream")
+	cmdCtx := cmd.New(".", format, cmd.Warn)
+	if _, _, err := cmdCtx.Execf("git clone -q %s %s", url, dsutil.PosixPath(dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	repoCtx := cmd.New(dir, format, cmd.Warn)
+	for _, command := range commands {
+		if _, _, err := repoCtx.Execf(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+	head, _, _ := repoCtx.Execf("git rev-parse HEAD")
+	return strings.TrimSpace(head)
+}
+
+func TestPin(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		p1Url, p2Url := ruleSet.Rules[0].Replace, ruleSet.Rules[1].Replace
+		releaseHead := upstreamf(t, format, p1Url,
+			"git checkout -q -b release",
+			`git commit -q --allow-empty -m "release"`,
+			"git push -q origin release")
+		upstreamf(t, format, p2Url,
+			"git tag v1.0.0",
+			`git commit -q --allow-empty -m "after the tag"`,
+			"git push -q --tags origin master")
+
+		ruleSet.Rules[0].Replace += "#release"
+		ruleSet.Rules[1].Replace += "@v1.0.0"
+
+		p1Dir := filepath.Join(goPath[0], "src", "gh", "u1", "p1")
+		p2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, TaggedOnly)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, releaseHead, ctx.head(p1Dir))
+		tagCommit, _ := ctx.gitf(p2Dir, "rev-parse v1.0.0^{commit}")
+		assert.Equal(t, tagCommit, ctx.head(p2Dir))
+
+		newReleaseHead := upstreamf(t, format, p1Url,
+			"git checkout -q release",
+			`git commit -q --allow-empty -m "release fix"`,
+			"git push -q origin release")
+		upstreamf(t, format, p2Url,
+			`git commit -q --allow-empty -m "more after the tag"`,
+			"git push -q origin master")
+
+		updateCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update)
+		assert.Nil(t, updateCtx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, newReleaseHead, updateCtx.head(p1Dir))
+		assert.Equal(t, tagCommit, updateCtx.head(p2Dir))
+	})
+}
@@ -0,0 +1,165 @@
+package getx
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/desal/dsutil"
+)
+
+//With the DryRun flag, Get only resolves rules and looks at what is already
+//on disk. Nothing is cloned, pulled, checked out, hooked or installed; the
+//only commands run are read only (git status, go list). Packages that would
+//be cloned can't be listed, so their dependencies don't appear in the plan.
+
+type PlanStep struct {
+	Pkg     string
+	Dir     string
+	Clone   bool     // Would be cloned from Url
+	Url     string   // Rule resolved url
+	Origin  string   // Url origin would be changed to
+	Link    string   // Working copy an override would symlink
+	Pull    bool     // Would be updated
+	Stash   bool     // Local changes would be stashed for the update
+	Skip    string   // Why an update would not happen
+	Retag   bool     // Would checkout the highest version tag
+	Pin     string   // Branch, tag or commit the rule pins to
+	Hooks   []string // Hook scripts that would run
+	Install bool     // Would be installed
+}
+
+type plan struct {
+	mu    sync.Mutex
+	steps []PlanStep
+	index map[string]int
+}
+
+func (s PlanStep) String() string {
+	actions := []string{}
+	if s.Clone {
+		actions = append(actions, fmt.Sprintf("clone %s into %s", s.Url, s.Dir))
+	}
+	if s.Link != "" {
+		actions = append(actions, "link to "+s.Link)
+	}
+	if s.Origin != "" {
+		actions = append(actions, "set origin to "+s.Origin)
+	}
+	if s.Stash {
+		actions = append(actions, "stash local changes")
+	}
+	if s.Pull {
+		actions = append(actions, "pull")
+	}
+	if s.Skip != "" {
+		actions = append(actions, "skip update ("+s.Skip+")")
+	}
+	if s.Retag {
+		actions = append(actions, "checkout highest version tag")
+	}
+	if s.Pin != "" {
+		actions = append(actions, "checkout "+s.Pin)
+	}
+	for _, hook := range s.Hooks {
+		actions = append(actions, "run "+hook)
+	}
+	if s.Install {
+		actions = append(actions, "install")
+	}
+	if len(actions) == 0 {
+		actions = append(actions, "nothing to do")
+	}
+	return fmt.Sprintf("%s: %s", s.Pkg, strings.Join(actions, ", "))
+}
+
+//Plan returns what a Get with the DryRun flag would have done.
+func (c *Context) Plan() []PlanStep {
+	c.plan.mu.Lock()
+	defer c.plan.mu.Unlock()
+	return append([]PlanStep{}, c.plan.steps...)
+}
+
+func (c *Context) planStep(pkg, goDir string, f func(s *PlanStep)) {
+	c.plan.mu.Lock()
+	defer c.plan.mu.Unlock()
+	i, ok := c.plan.index[pkg]
+	if !ok {
+		i = len(c.plan.steps)
+		c.plan.index[pkg] = i
+		c.plan.steps = append(c.plan.steps, PlanStep{Pkg: pkg, Dir: goDir})
+	}
+	f(&c.plan.steps[i])
+}
+
+func (c *Context) planHook(goDir, filename string) bool {
+	return c.flags.Checked(ApplyHooks) && dsutil.CheckPath(filepath.Join(goDir, filename))
+}
+
+func (c *Context) planClone(rootPkg, goDir string, remote Remote) {
+	c.planStep(rootPkg, goDir, func(s *PlanStep) {
+		s.Clone = true
+		s.Url = remote.Url
+		s.Pin = remote.pin()
+		s.Retag = c.tagged(remote)
+		s.Install = c.flags.Checked(Install)
+	})
+}
+
+func (c *Context) planInspect(pkg, goDir string) error {
+	vcs, _ := c.repoVCS(goDir)
+	remote, _ := c.ruleSet.ruleRemote(pkg)
+	if origin, _ := vcs.Origin(goDir); remote.Url != "" && origin != remote.Url && c.flags.Checked(FixOrigin) {
+		c.planStep(pkg, goDir, func(s *PlanStep) { s.Origin = remote.Url })
+	}
+
+	if !c.flags.Checked(Update) {
+		c.planStep(pkg, goDir, func(s *PlanStep) {})
+		return nil
+	}
+
+	clean, status, err := vcs.Status(goDir)
+	if err != nil {
+		return c.errorf("Failed to get %s status for package %s (%s): %s",
+			vcs.Name(), pkg, goDir, err.Error())
+	}
+
+	c.planStep(pkg, goDir, func(s *PlanStep) {
+		if c.planHook(goDir, "get-before-update.sh") {
+			s.Hooks = append(s.Hooks, "get-before-update.sh")
+		}
+		if !clean && !c.updatePolicy(remote).stashes() {
+			s.Skip = vcs.Name() + " status is " + status
+			return
+		}
+		s.Stash = !clean
+		if remote.Ref == "" {
+			//Read only, DefaultBranch may ask origin and remembers the answer
+			branch, current := remote.Branch, ""
+			if branch == "" {
+				branch = vcs.KnownDefaultBranch(goDir)
+				current, _ = vcs.Branch(goDir)
+			}
+			if branch != "" && current != "" && current != branch {
+				s.Skip = "on branch " + current + " rather than " + branch
+				return
+			}
+		}
+		s.Pull = remote.Ref == ""
+		s.Pin = remote.pin()
+		s.Retag = c.tagged(remote)
+	})
+	return nil
+}
+
+func (c *Context) planInstall(p pendingInstall) {
+	c.planStep(p.pkg, p.goDir, func(s *PlanStep) {
+		for _, hook := range []string{"get-before-install.sh", "get-after-install.sh"} {
+			if c.planHook(p.goDir, hook) {
+				s.Hooks = append(s.Hooks, hook)
+			}
+		}
+		s.Install = c.flags.Checked(Install)
+	})
+}
@@ -0,0 +1,61 @@
+package getx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/dsutil"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		{
+			ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+			ctx.Get(".", "gh/u1/p1", false, false)
+		}
+
+		depDir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		os.RemoveAll(depDir)
+
+		//Nothing is remembered by a dry run
+		p1Dir := filepath.Join(goPath[0], "src", "gh", "u1", "p1")
+		ctx := New(format, goPath, ruleSet, "", MustPanic, Update, Install, RecurseTopLevel, DryRun)
+		ctx.gitf(p1Dir, "config --unset getx.defaultBranch")
+		config, _ := ctx.gitf(p1Dir, "config --list --local")
+
+		ctx.Get(".", "gh/u1/p1", false, false)
+		after, _ := ctx.gitf(p1Dir, "config --list --local")
+		assert.Equal(t, config, after)
+
+		_, depUrl, _ := ruleSet.GetUrl("gh/u2/p1")
+		assert.Equal(t, []PlanStep{
+			{
+				Pkg:     "gh/u1/p1",
+				Dir:     p1Dir,
+				Pull:    true,
+				Install: true,
+			},
+			{
+				Pkg:     "gh/u2/p1",
+				Dir:     depDir,
+				Clone:   true,
+				Url:     depUrl,
+				Install: true,
+			},
+		}, ctx.Plan())
+
+		assert.False(t, dsutil.CheckPath(depDir))
+	})
+}
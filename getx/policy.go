@@ -0,0 +1,136 @@
+package getx
+
+import "fmt"
+
+//An update policy says what an update does with local changes and commits.
+//Whatever the policy, a stash or rebase that conflicts puts the checkout back
+//the way it was, and the package is skipped.
+
+type UpdatePolicy string
+
+const (
+	PolicySkip   UpdatePolicy = "skip"    // Skip dirty checkouts, merge local commits (the default)
+	PolicyStash  UpdatePolicy = "stash"   // Stash local changes, update, then unstash them
+	PolicyRebase UpdatePolicy = "rebase"  // Stash local changes, and rebase local commits onto upstream
+	PolicyFFOnly UpdatePolicy = "ff-only" // Skip dirty checkouts, and those with local commits
+)
+
+var updatePolicies = []UpdatePolicy{PolicySkip, PolicyStash, PolicyRebase, PolicyFFOnly}
+
+func ParseUpdatePolicy(s string) (UpdatePolicy, error) {
+	for _, policy := range updatePolicies {
+		if string(policy) == s {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown update policy %q", s)
+}
+
+func (p UpdatePolicy) stashes() bool {
+	return p == PolicyStash || p == PolicyRebase
+}
+
+//SetUpdatePolicy sets the policy for repositories whose rule doesn't give
+//one with the update attribute.
+func (c *Context) SetUpdatePolicy(policy UpdatePolicy) {
+	c.policy = policy
+}
+
+func (c *Context) updatePolicy(remote Remote) UpdatePolicy {
+	if remote.Policy != "" {
+		return remote.Policy
+	}
+	return c.policy
+}
+
+//update moves a checkout on to the latest commit of the branch it tracks, or
+//to the ref its rule pins. Failures are warned about and recorded as skips.
+//Returns true if it was pulled.
+func (c *Context) update(vcs VCS, pkg, goDir string, remote Remote, policy UpdatePolicy) bool {
+	if remote.Ref != "" {
+		err := c.checkoutRef(vcs, goDir, remote.Ref)
+		if err != nil {
+			c.warnf("Not updating package %s (%s), Couldn't checkout %s: %s",
+				pkg, goDir, remote.Ref, err.Error())
+			c.skipped(pkg, goDir, SkipCheckoutFailed)
+		}
+	} else if branch, current, err := c.updateBranch(vcs, goDir, remote); err != nil {
+		c.warnf("Not updating package %s (%s), Couldn't find the branch to update: %s",
+			pkg, goDir, err.Error())
+		c.skipped(pkg, goDir, SkipCheckoutFailed)
+	} else if current != "" && current != branch {
+		c.warnf("Not updating package %s (%s), on branch %s rather than %s",
+			pkg, goDir, current, branch)
+		c.skipped(pkg, goDir, SkipOtherBranch)
+	} else if err := vcs.Checkout(goDir, branch); err != nil {
+		c.warnf("Not updating package %s (%s), Couldn't checkout %s: %s",
+			pkg, goDir, branch, err.Error())
+		c.skipped(pkg, goDir, SkipCheckoutFailed)
+	} else if policy == PolicyFFOnly {
+		if err := vcs.FastForward(goDir); err != nil {
+			c.warnf("Not updating package %s (%s), Couldn't fast-forward: %s",
+				pkg, goDir, err.Error())
+			c.skipped(pkg, goDir, SkipNotFastForward)
+			return false
+		}
+		return true
+	} else if policy == PolicyRebase {
+		fromCommit, _ := vcs.Head(goDir)
+		if err := vcs.Rebase(goDir); err != nil {
+			c.warnf("Not updating package %s (%s), Couldn't rebase local commits: %s",
+				pkg, goDir, err.Error())
+			c.skipped(pkg, goDir, SkipConflict)
+			return false
+		}
+		toCommit, _ := vcs.Head(goDir)
+		rebased, _ := vcs.Commits(goDir, toCommit, fromCommit)
+		c.result(pkg, goDir, func(r *Result) { r.Rebased = len(rebased) })
+		return true
+	} else if err := vcs.Pull(goDir); err != nil {
+		c.warnf("Not updating package %s (%s), Couldn't pull: %s",
+			pkg, goDir, err.Error())
+		c.skipped(pkg, goDir, SkipPullFailed)
+	} else {
+		return true
+	}
+	return false
+}
+
+//stashAndUpdate updates a dirty checkout with its changes stashed. If they
+//don't apply cleanly afterwards, the update is undone and they are applied
+//where they came from.
+func (c *Context) stashAndUpdate(vcs VCS, pkg, goDir string, remote Remote, policy UpdatePolicy) bool {
+	fromCommit, _ := vcs.Head(goDir)
+	fromBranch, _ := vcs.Branch(goDir)
+
+	stashed, err := vcs.Stash(goDir)
+	if err != nil {
+		c.warnf("Not updating package %s (%s), Couldn't stash local changes: %s",
+			pkg, goDir, err.Error())
+		c.skipped(pkg, goDir, SkipStashFailed)
+		return false
+	} else if !stashed {
+		//Only untracked files, which are left where they are
+		return c.update(vcs, pkg, goDir, remote, policy)
+	}
+	c.result(pkg, goDir, func(r *Result) { r.Stashed = true })
+	c.stashed(pkg)
+
+	updated := c.update(vcs, pkg, goDir, remote, policy)
+	if err := vcs.Unstash(goDir); err == nil {
+		return updated
+	} else if updated {
+		c.warnf("Not updating package %s (%s), local changes conflict with the update: %s",
+			pkg, goDir, err.Error())
+		c.skipped(pkg, goDir, SkipConflict)
+	}
+
+	if err := vcs.Rollback(goDir, fromBranch, fromCommit); err != nil {
+		c.warnf("Failed to put package %s (%s) back on %s, local changes are stashed: %s",
+			pkg, goDir, fromCommit, err.Error())
+	} else if err := vcs.Unstash(goDir); err != nil {
+		c.warnf("Failed to unstash local changes to package %s (%s), they are still stashed: %s",
+			pkg, goDir, err.Error())
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package getx
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/cmd"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdatePolicy(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		p2Url := ruleSet.Rules[1].Replace
+		upstreamf(t, format, p2Url,
+			"echo one > notes.txt && git add notes.txt",
+			`git commit -q -m "notes"`,
+			"git push -q origin master")
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+
+		p2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		p2Ctx := cmd.New(p2Dir, format, cmd.Warn)
+		notes := filepath.Join(p2Dir, "notes.txt")
+		readNotes := func() string {
+			b, _ := ioutil.ReadFile(notes)
+			return string(b)
+		}
+		update := func(policy UpdatePolicy) Result {
+			ctx := New(format, goPath, ruleSet, "", Warn, RecurseTopLevel, Update)
+			ctx.SetUpdatePolicy(policy)
+			assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+			return ctx.Results()[1]
+		}
+
+		//Local changes are stashed and put back
+		assert.Nil(t, ioutil.WriteFile(notes, []byte("local\n"), 0644))
+		head := upstreamf(t, format, p2Url, `git commit -q --allow-empty -m "second"`, "git push -q origin master")
+		assert.Equal(t, []SkipReason{SkipDirty}, update(PolicySkip).Skipped)
+		result := update(PolicyStash)
+		assert.True(t, result.Stashed)
+		assert.Equal(t, head, result.ToCommit)
+		assert.Equal(t, "local\n", readNotes())
+
+		//Conflicting local changes undo the update
+		upstreamf(t, format, p2Url, "echo upstream > notes.txt", `git commit -q -am "conflict"`, "git push -q origin master")
+		result = update(PolicyStash)
+		assert.Equal(t, []SkipReason{SkipConflict}, result.Skipped)
+		assert.Equal(t, head, ctx.head(p2Dir))
+		assert.Equal(t, "local\n", readNotes())
+
+		//Local commits are only fast-forwarded with nothing to rebase
+		_, _, err := p2Ctx.Execf(`git checkout -q notes.txt && git commit -q --allow-empty -m "local"`)
+		assert.Nil(t, err)
+		local := ctx.head(p2Dir)
+		result = update(PolicyFFOnly)
+		assert.Equal(t, []SkipReason{SkipNotFastForward}, result.Skipped)
+		assert.Equal(t, local, ctx.head(p2Dir))
+
+		head = upstreamf(t, format, p2Url)
+		result = update(PolicyRebase)
+		assert.Nil(t, result.Skipped)
+		assert.Equal(t, 1, result.Rebased)
+		parent, _ := ctx.gitf(p2Dir, "rev-parse HEAD^")
+		assert.Equal(t, head, parent)
+	})
+}
+
+func TestUpdatePolicyRule(t *testing.T) {
+	rule, err := NewRule("a/hats", "http://server/hats.git update=rebase")
+	if assert.Nil(t, err) {
+		assert.Equal(t, PolicyRebase, rule.remote("a/hats", rule.Replace).Policy)
+	}
+	_, err = NewRule("a/hats", "http://server/hats.git update=sometimes")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,254 @@
+package getx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+//Results record what Get did to each package, for callers that would rather
+//not parse the verbose output.
+
+type SkipReason string
+
+const (
+	SkipDirty          SkipReason = "dirty"            // Working tree not clean, not updated
+	SkipCheckoutFailed SkipReason = "checkout-failed"  // Couldn't checkout the branch to update
+	SkipPullFailed     SkipReason = "pull-failed"      //
+	SkipNoTags         SkipReason = "no-tags"          // No version tag (satisfying the constraint) to checkout
+	SkipOtherBranch    SkipReason = "other-branch"     // Checkout is on a branch other than the one updated
+	SkipNotFastForward SkipReason = "not-fast-forward" // With PolicyFFOnly, local commits or a failed pull
+	SkipStashFailed    SkipReason = "stash-failed"     //
+	SkipConflict       SkipReason = "conflict"         // Stash or rebase conflicted, checkout put back as it was
+)
+
+type Result struct {
+	Pkg               string       `json:"pkg"`
+	Dir               string       `json:"dir"`
+	Cloned            bool         `json:"cloned,omitempty"`
+	Override          string       `json:"override,omitempty"` // Working copy linked in place of a clone
+	Origin            string       `json:"origin,omitempty"`   // Origin, if it isn't the url the rule gives
+	OriginFixed       bool         `json:"originFixed,omitempty"`
+	FromCommit        string       `json:"fromCommit,omitempty"`
+	FromTag           string       `json:"fromTag,omitempty"`
+	ToCommit          string       `json:"toCommit,omitempty"`
+	ToTag             string       `json:"toTag,omitempty"`
+	Log               []string     `json:"log,omitempty"` // With ChangeLog, "+ " or "- " and a commit for updates
+	Skipped           []SkipReason `json:"skipped,omitempty"`
+	Stashed           bool         `json:"stashed,omitempty"`        // Local changes were stashed for the update
+	Rebased           int          `json:"rebased,omitempty"`        // Local commits rebased onto upstream
+	UpstreamBehind    int          `json:"upstreamBehind,omitempty"` // For forks, upstream commits missing from the fork
+	RebasedOnUpstream bool         `json:"rebasedOnUpstream,omitempty"`
+	Installed         bool         `json:"installed,omitempty"`
+	InstallFailed     []string     `json:"installFailed,omitempty"`
+	HookFailures      []string     `json:"hookFailures,omitempty"`
+	RolledBack        bool         `json:"rolledBack,omitempty"` // Put back by a failed Transactional Get
+}
+
+type results struct {
+	mu    sync.Mutex
+	list  []Result
+	index map[string]int
+}
+
+//Updated is true if an existing checkout was moved to a different commit.
+func (r Result) Updated() bool {
+	return !r.Cloned && !r.RolledBack && r.FromCommit != "" && r.FromCommit != r.ToCommit
+}
+
+//Err returns the failures recorded for the package as an *Error, or nil.
+//Install failures take precedence over hook failures.
+func (r Result) Err() error {
+	if len(r.InstallFailed) > 0 {
+		return newError(ErrInstall, r.Pkg, r.Dir, nil, "Failed to install %s: %s",
+			r.Pkg, strings.Join(r.InstallFailed, ", "))
+	} else if len(r.HookFailures) > 0 {
+		return newError(ErrHook, r.Pkg, r.Dir, nil, "Failed to run hook script '%s' for package %s (%s)",
+			r.HookFailures[0], r.Pkg, r.Dir)
+	} else if len(r.Skipped) > 0 && r.Skipped[0] == SkipDirty {
+		return newError(ErrDirty, r.Pkg, r.Dir, nil, "Not updating package %s (%s), working tree is dirty",
+			r.Pkg, r.Dir)
+	}
+	return nil
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+func (r Result) String() string {
+	actions := []string{}
+	if r.Override != "" {
+		actions = append(actions, "linked to "+r.Override)
+	}
+	if r.Cloned {
+		actions = append(actions, "cloned at "+shortCommit(r.ToCommit)+tagChange("", r.ToTag))
+	} else if r.Updated() {
+		actions = append(actions, fmt.Sprintf("updated %s..%s%s",
+			shortCommit(r.FromCommit), shortCommit(r.ToCommit), tagChange(r.FromTag, r.ToTag)))
+	}
+	if r.OriginFixed {
+		actions = append(actions, "origin changed from "+r.Origin)
+	} else if r.Origin != "" {
+		actions = append(actions, "origin differs from rule: "+r.Origin)
+	}
+	if r.Stashed {
+		actions = append(actions, "stashed local changes")
+	}
+	if r.Rebased > 0 {
+		actions = append(actions, fmt.Sprintf("rebased %d local commits", r.Rebased))
+	}
+	if r.RebasedOnUpstream {
+		actions = append(actions, fmt.Sprintf("rebased onto %d upstream commits", r.UpstreamBehind))
+	} else if r.UpstreamBehind > 0 {
+		actions = append(actions, fmt.Sprintf("%d commits behind upstream", r.UpstreamBehind))
+	}
+	for _, skip := range r.Skipped {
+		actions = append(actions, "skipped: "+string(skip))
+	}
+	if len(r.InstallFailed) > 0 {
+		actions = append(actions, "install failed: "+strings.Join(r.InstallFailed, ", "))
+	} else if r.Installed {
+		actions = append(actions, "installed")
+	}
+	for _, hook := range r.HookFailures {
+		actions = append(actions, "hook failed: "+hook)
+	}
+	if r.RolledBack {
+		actions = append(actions, "rolled back")
+	}
+	if len(actions) == 0 {
+		actions = append(actions, "unchanged")
+	}
+	return strings.Join(actions, ", ")
+}
+
+//Results returns what Get has done to each package, in the order they were
+//first reached.
+func (c *Context) Results() []Result {
+	c.results.mu.Lock()
+	defer c.results.mu.Unlock()
+	return append([]Result{}, c.results.list...)
+}
+
+func (c *Context) result(pkg, goDir string, f func(r *Result)) {
+	c.results.mu.Lock()
+	defer c.results.mu.Unlock()
+	i, ok := c.results.index[pkg]
+	if !ok {
+		i = len(c.results.list)
+		c.results.index[pkg] = i
+		c.results.list = append(c.results.list, Result{Pkg: pkg, Dir: goDir})
+	}
+	f(&c.results.list[i])
+}
+
+func tagChange(from, to string) string {
+	if from == to {
+		return ""
+	} else if from == "" {
+		return " (" + to + ")"
+	} else if to == "" {
+		return " (was " + from + ")"
+	}
+	return " (" + from + " -> " + to + ")"
+}
+
+//finishResults fills in the tags each repository ended up on, and with the
+//ChangeLog flag the commits between old and new for updates. Done once Get
+//has finished, as manifests can move repositories after they were fetched.
+func (c *Context) finishResults() {
+	c.results.mu.Lock()
+	defer c.results.mu.Unlock()
+
+	for i := range c.results.list {
+		r := &c.results.list[i]
+		vcs, ok := c.repoVCS(r.Dir)
+		if r.ToCommit == "" || !ok {
+			continue
+		}
+		r.ToTag = exactTag(vcs, r.Dir)
+
+		r.Log = nil
+		if !r.Updated() || !c.flags.Checked(ChangeLog) {
+			continue
+		}
+		added, _ := vcs.Log(r.Dir, r.FromCommit, r.ToCommit)
+		for _, line := range added {
+			r.Log = append(r.Log, "+ "+line)
+		}
+		removed, _ := vcs.Log(r.Dir, r.ToCommit, r.FromCommit)
+		for _, line := range removed {
+			r.Log = append(r.Log, "- "+line)
+		}
+	}
+}
+
+//installErr returns an ErrInstall error if any of pkg failed to install.
+func (c *Context) installErr(pkg string) error {
+	c.results.mu.Lock()
+	defer c.results.mu.Unlock()
+	i, ok := c.results.index[pkg]
+	if !ok || len(c.results.list[i].InstallFailed) == 0 {
+		return nil
+	}
+	return c.results.list[i].Err()
+}
+
+func (c *Context) skipped(pkg, goDir string, reason SkipReason) {
+	c.result(pkg, goDir, func(r *Result) { r.Skipped = append(r.Skipped, reason) })
+}
+
+func (c *Context) installResult(pkg, goDir string, failed []string) {
+	c.result(pkg, goDir, func(r *Result) {
+		r.Installed = len(failed) == 0
+		if len(failed) > 0 {
+			r.InstallFailed = failed
+		}
+	})
+}
+
+func WriteResultsTable(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tRESULT")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\n", r.Pkg, r.String())
+	}
+	return tw.Flush()
+}
+
+//WriteUpdateReport writes the old and new commit of every repository that
+//was updated, followed by its Log if there is one.
+func WriteUpdateReport(w io.Writer, results []Result) error {
+	for _, r := range results {
+		if !r.Updated() {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "%s: %s..%s%s\n", r.Pkg,
+			shortCommit(r.FromCommit), shortCommit(r.ToCommit), tagChange(r.FromTag, r.ToTag))
+		if err != nil {
+			return err
+		}
+		for _, line := range r.Log {
+			if _, err := fmt.Fprintf(w, "    %s\n", line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func WriteResultsJSON(w io.Writer, results []Result) error {
+	b, err := json.MarshalIndent(results, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,121 @@
+package getx
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResults(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"),
+		Pkg("gh/u1/p1/s2", "gh/u1/p1/missing1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		{
+			ctx := New(format, goPath, ruleSet, "", Install, RecurseTopLevel)
+			err := ctx.Get(".", "gh/u1/p1", false, false)
+			assert.True(t, errors.Is(err, ErrInstall))
+
+			results := ctx.Results()
+			if !assert.Len(t, results, 2) {
+				return
+			}
+
+			assert.Equal(t, "gh/u1/p1", results[0].Pkg)
+			assert.True(t, results[0].Cloned)
+			assert.Len(t, results[0].ToCommit, 40)
+			assert.False(t, results[0].Installed)
+			assert.Equal(t, []string{".../s2"}, results[0].InstallFailed)
+			assert.True(t, errors.Is(results[0].Err(), ErrInstall))
+
+			assert.Equal(t, "gh/u2/p1", results[1].Pkg)
+			assert.True(t, results[1].Cloned)
+			assert.True(t, results[1].Installed)
+		}
+
+		dirtyFile := filepath.Join(goPath[0], "src", "gh", "u2", "p1", "scratch.txt")
+		assert.Nil(t, ioutil.WriteFile(dirtyFile, []byte("scratch"), 0644))
+
+		ctx := New(format, goPath, ruleSet, "", Update, RecurseTopLevel)
+		ctx.Get(".", "gh/u1/p1", false, false)
+
+		results := ctx.Results()
+		if !assert.Len(t, results, 2) {
+			return
+		}
+		assert.Equal(t, "gh/u1/p1", results[0].Pkg)
+		assert.False(t, results[0].Cloned)
+		assert.False(t, results[0].Updated())
+		assert.Equal(t, results[0].FromCommit, results[0].ToCommit)
+		assert.Equal(t, "unchanged", results[0].String())
+
+		assert.Equal(t, "gh/u2/p1", results[1].Pkg)
+		assert.Equal(t, []SkipReason{SkipDirty}, results[1].Skipped)
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, WriteResultsTable(buf, results))
+		assert.Equal(t, `PACKAGE   RESULT
+gh/u1/p1  unchanged
+gh/u2/p1  skipped: dirty
+`, buf.String())
+	})
+}
+
+func TestUpdateReport(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		url := ruleSet.Rules[0].Replace
+		upstreamf(t, format, url, "git tag v1.0.0", "git push -q --tags origin master")
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		from := ctx.Results()[0].ToCommit
+
+		to := upstreamf(t, format, url,
+			`git commit -q --allow-empty -m "First fix"`,
+			`git commit -q --allow-empty -m "Second fix"`,
+			"git tag v1.0.1",
+			"git push -q --tags origin master")
+
+		updateCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update, ChangeLog)
+		assert.Nil(t, updateCtx.Get(".", "gh/u1/p1", false, false))
+
+		results := updateCtx.Results()
+		if !assert.Len(t, results, 1) {
+			return
+		}
+		r := results[0]
+		assert.True(t, r.Updated())
+		assert.Equal(t, "v1.0.0", r.FromTag)
+		assert.Equal(t, "v1.0.1", r.ToTag)
+		if assert.Len(t, r.Log, 2) {
+			assert.Equal(t, "+ "+to[:7]+" Second fix", r.Log[0])
+			assert.True(t, strings.HasPrefix(r.Log[1], "+ "))
+			assert.True(t, strings.HasSuffix(r.Log[1], " First fix"))
+		}
+
+		buf := &bytes.Buffer{}
+		assert.Nil(t, WriteUpdateReport(buf, results))
+		assert.True(t, strings.HasPrefix(buf.String(),
+			"gh/u1/p1: "+from[:7]+".."+to[:7]+" (v1.0.0 -> v1.0.1)\n    + "+to[:7]+" Second fix\n"))
+	})
+}
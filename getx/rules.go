@@ -2,36 +2,168 @@ package getx
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+
+	"github.com/desal/dsutil"
 )
 
+//A rule maps import paths matching Re to the url in Replace. The url may be
+//followed by whitespace separated key=value attributes:
+//  vcs=hg  the repository isn't git (a hg+ prefix on the url does the same)
+//  update=stash  the UpdatePolicy for the repository
+//  upstream=url  the repository is a fork of url (see UpstreamRemote)
+//The url may also pin the repository to a branch other than the default with
+//url#branch, or to a tag or commit with url@ref. Pins are honoured on clone
+//and on update, and take precedence over the TaggedOnly flag. A version
+//constraint (url@^1.2, see Constraint) instead picks the highest satisfying
+//tag.
+
 type Rule struct {
 	Re      *regexp.Regexp
 	Replace string
+	Attrs   map[string]string
+	File    string // Where the rule was loaded from, if anywhere
+	Line    int    // Line number within File
+}
+
+//Remote is where the repository for an import path is fetched from.
+type Remote struct {
+	Root       string // Import path of the repository root
+	Url        string
+	VCS        string
+	Branch     string // Branch to track instead of the default
+	Ref        string // Tag or commit to stay on
+	Constraint string // Version constraint tags are chosen by
+	Policy     UpdatePolicy
+	Upstream   string // Url the repository is a fork of
+}
+
+//Pinned is true if the remote names a branch or ref to use.
+func (r Remote) Pinned() bool {
+	return r.Branch != "" || r.Ref != ""
+}
+
+//pin returns the branch or ref the remote is pinned to, for messages.
+func (r Remote) pin() string {
+	if r.Ref != "" {
+		return r.Ref
+	}
+	return r.Branch
 }
 
 type RuleSet struct {
-	Rules []Rule
+	Rules     []Rule
+	Overrides map[string]string // Import root to local working copy, see AddOverride
+	Discovery *Discovery        // Tried when no rule matches, if set
+}
+
+//RuleError is a rule that couldn't be parsed or compiled.
+type RuleError struct {
+	File string
+	Line int
+	Text string
+	Err  error
 }
 
-func NewRule(match, replace string) Rule {
+func (e *RuleError) Error() string {
+	location := e.File
+	if location == "" {
+		location = "rules"
+	}
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, e.Line)
+	}
+	return fmt.Sprintf("%s: %s: %q", location, e.Err.Error(), e.Text)
+}
+
+func (e *RuleError) Unwrap() error { return e.Err }
+
+func NewRule(match, replace string) (Rule, error) {
 	r := Rule{}
 	match = "^" + strings.TrimSpace(match)
 
 	var err error
 	r.Re, err = regexp.Compile(match)
-
 	if err != nil {
-		fmt.Println("Regexp Error:", err.Error())
-		os.Exit(1)
+		return Rule{}, err
+	}
+
+	fields := strings.Fields(replace)
+	if len(fields) == 0 {
+		return Rule{}, errors.New("missing url")
+	}
+	r.Replace = fields[0]
+	r.Attrs = map[string]string{}
+	for _, attr := range fields[1:] {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 {
+			return Rule{}, fmt.Errorf("expected key=value attribute, got %q", attr)
+		}
+		switch kv[0] {
+		case "vcs":
+			if !isVCSName(kv[1]) {
+				return Rule{}, fmt.Errorf("unsupported vcs %q", kv[1])
+			}
+		case "update":
+			if _, err := ParseUpdatePolicy(kv[1]); err != nil {
+				return Rule{}, err
+			}
+		case "upstream":
+			if kv[1] == "" {
+				return Rule{}, errors.New("missing upstream url")
+			}
+		default:
+			return Rule{}, fmt.Errorf("unknown attribute %q", kv[0])
+		}
+		r.Attrs[kv[0]] = kv[1]
 	}
 
-	r.Replace = strings.TrimSpace(replace)
-	return r
+	if remote := r.remote("", r.Replace); remote.Constraint != "" {
+		if _, err := ParseConstraint(remote.Constraint); err != nil {
+			return Rule{}, err
+		}
+	}
+	return r, nil
+}
+
+//remote builds the Remote for a match, taking the VCS from the vcs attribute
+//or a vcs+ prefix on the url.
+func (r *Rule) remote(goImport, url string) Remote {
+	vcs := "git"
+	for _, name := range vcsNames {
+		if name != "git" && strings.HasPrefix(url, name+"+") {
+			vcs = name
+			url = strings.TrimPrefix(url, name+"+")
+		}
+	}
+	if attr, ok := r.Attrs["vcs"]; ok {
+		vcs = attr
+	}
+
+	remote := Remote{
+		Root:     goImport,
+		Url:      url,
+		VCS:      vcs,
+		Policy:   UpdatePolicy(r.Attrs["update"]),
+		Upstream: r.Attrs["upstream"],
+	}
+	if i := strings.LastIndex(url, "#"); i >= 0 {
+		remote.Url, remote.Branch = url[:i], url[i+1:]
+	} else if i := strings.LastIndex(url, "@"); i > strings.LastIndex(url, "/") && i > strings.LastIndex(url, ":") {
+		//An @ before the path is part of the host (git@server:repo.git)
+		remote.Url, remote.Ref = url[:i], url[i+1:]
+		if strings.IndexAny(remote.Ref, "^~<>=") == 0 {
+			remote.Ref, remote.Constraint = "", remote.Ref
+		}
+	}
+	return remote
 }
 
 func (r *Rule) tryRegex(s string) (goImport, gitUrl string, success bool) {
@@ -43,38 +175,182 @@ func (r *Rule) tryRegex(s string) (goImport, gitUrl string, success bool) {
 }
 
 func (r *RuleSet) GetUrl(pkg string) (goImport, gitUrl string, err error) {
+	remote, err := r.Resolve(pkg)
+	return remote.Root, remote.Url, err
+}
+
+//Resolve finds the repository for pkg from the first matching rule, falling
+//back to Discovery.
+func (r *RuleSet) Resolve(pkg string) (Remote, error) {
+	if remote, ok := r.ruleRemote(pkg); ok {
+		return remote, nil
+	}
+	if r.Discovery == nil {
+		return Remote{}, newError(ErrNoRule, pkg, "", nil, "Could not find a rule matching %s", pkg)
+	}
+
+	discovered, err := r.Discovery.Discover(pkg)
+	if err != nil {
+		return Remote{}, newError(ErrNoRule, pkg, "", err, "Could not find a rule matching %s: %s", pkg, err.Error())
+	}
+	return Remote{Root: discovered.Import.Prefix, Url: discovered.Import.RepoRoot, VCS: discovered.Import.VCS}, nil
+}
+
+//ruleRemote resolves pkg from the rules only, never making a request.
+func (r *RuleSet) ruleRemote(pkg string) (Remote, bool) {
 	for _, rule := range r.Rules {
 		goImport, gitUrl, ok := rule.tryRegex(pkg)
 		if ok {
-			return goImport, gitUrl, nil
+			return rule.remote(goImport, gitUrl), true
 		}
 	}
-	return "", "", fmt.Errorf("Could not find a rule matching %s", pkg)
+	return Remote{}, false
+}
+
+//RuleMatch is a rule that matches an import path, and what it maps it to.
+type RuleMatch struct {
+	Rule  Rule
+	Index int // Position of the rule in the RuleSet
+	Remote
+}
+
+//Matches returns every rule matching pkg, in the order they are tried. Only
+//the first is ever used by GetUrl, the rest are shadowed by it.
+func (r *RuleSet) Matches(pkg string) []RuleMatch {
+	matches := []RuleMatch{}
+	for i, rule := range r.Rules {
+		goImport, gitUrl, ok := rule.tryRegex(pkg)
+		if ok {
+			matches = append(matches, RuleMatch{rule, i, rule.remote(goImport, gitUrl)})
+		}
+	}
+	return matches
+}
+
+//Location describes where the rule came from, for messages.
+func (r Rule) Location() string {
+	if r.Line == 0 {
+		return "(builtin)"
+	} else if r.File == "" {
+		return fmt.Sprintf("line %d", r.Line)
+	}
+	return fmt.Sprintf("%s:%d", r.File, r.Line)
+}
+
+func (r Rule) String() string {
+	keys := []string{}
+	for key, _ := range r.Attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	s := strings.TrimPrefix(r.Re.String(), "^") + "=" + r.Replace
+	for _, key := range keys {
+		s += " " + key + "=" + r.Attrs[key]
+	}
+	return s
 }
 
 func LoadRulesFromFile(filename string) (RuleSet, error) {
+	return loadRulesFromFile(filename, nil)
+}
+
+func loadRulesFromFile(filename string, including []string) (RuleSet, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return RuleSet{}, err
 	}
 	defer file.Close()
-	return LoadRules(file)
+	return loadRules(file, filename, including)
 }
 
+//LoadRules reads rules from r. Any include directives are relative to the
+//working directory.
 func LoadRules(r io.Reader) (RuleSet, error) {
+	return loadRules(r, "", nil)
+}
+
+//stripComment removes a # comment from a rule line. A # only starts a
+//comment at the start of the line or after whitespace, so it can still be
+//used inside urls.
+func stripComment(text string) string {
+	for i, ch := range text {
+		if ch == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t') {
+			return text[:i]
+		}
+	}
+	return text
+}
+
+//includePath returns the file named by an "include <file>" directive, if
+//text is one. Relative paths are relative to the including file.
+func includePath(text, filename string) (string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 || fields[0] != "include" || strings.Contains(text, "=") {
+		return "", false
+	}
+	path := expandHome(fields[1])
+	if !filepath.IsAbs(path) && filename != "" {
+		path = filepath.Join(filepath.Dir(filename), path)
+	}
+	return path, true
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(dsutil.UserHomeDir(), strings.TrimPrefix(path, "~"))
+	}
+	return path
+}
+
+func loadRules(r io.Reader, filename string, including []string) (RuleSet, error) {
+	including = append(including, filename)
+
+	ruleSet := RuleSet{}
 	rules := []Rule{}
 	scanner := bufio.NewScanner(r)
+	lineNo := 0
 	for scanner.Scan() {
-		text := scanner.Text()
-		if string(text[0]) == "#" {
+		lineNo++
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+
+		if path, ok := includePath(text, filename); ok {
+			if stringInSlice(including, path) {
+				return RuleSet{}, &RuleError{filename, lineNo, scanner.Text(), errors.New("include cycle")}
+			}
+			included, err := loadRulesFromFile(path, including)
+			if err != nil {
+				return RuleSet{}, &RuleError{filename, lineNo, scanner.Text(), err}
+			}
+			rules = append(rules, included.Rules...)
+			ruleSet.addOverrides(included.Overrides)
+			continue
+		}
+
+		if root, dir, ok := overrideDirective(text, filename); ok {
+			ruleSet.addOverrides(map[string]string{root: dir})
 			continue
 		}
 
 		ruleDef := strings.SplitN(text, "=", 2)
 		if len(ruleDef) < 2 {
-			continue
+			return RuleSet{}, &RuleError{filename, lineNo, scanner.Text(), errors.New("expected pattern=url")}
+		}
+
+		rule, err := NewRule(ruleDef[0], ruleDef[1])
+		if err != nil {
+			return RuleSet{}, &RuleError{filename, lineNo, scanner.Text(), err}
 		}
-		rules = append(rules, NewRule(ruleDef[0], ruleDef[1]))
+		rule.File = filename
+		rule.Line = lineNo
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return RuleSet{}, err
 	}
-	return RuleSet{rules}, nil
+	ruleSet.Rules = rules
+	return ruleSet, nil
 }
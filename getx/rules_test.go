@@ -0,0 +1,98 @@
+package getx
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRules(t *testing.T) {
+	ruleSet, err := LoadRules(strings.NewReader(`# Example config
+
+a/hats=http://server/special_repos/hats.git#release # pinned for now
+   
+a/([^/]+)=http://server/repos/$1.git	# everything else in a
+	# indented comment
+b/([^/]+) = http://other/repos/$1.git
+`))
+	if !assert.Nil(t, err) || !assert.Len(t, ruleSet.Rules, 3) {
+		return
+	}
+
+	assert.Equal(t, "http://server/special_repos/hats.git#release", ruleSet.Rules[0].Replace)
+	assert.Equal(t, 3, ruleSet.Rules[0].Line)
+	assert.Equal(t, 5, ruleSet.Rules[1].Line)
+	assert.Equal(t, 7, ruleSet.Rules[2].Line)
+
+	root, url, err := ruleSet.GetUrl("b/shoes/laces")
+	assert.Nil(t, err)
+	assert.Equal(t, "b/shoes", root)
+	assert.Equal(t, "http://other/repos/shoes.git", url)
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	_, err := loadRules(strings.NewReader("a/x=http://server/x.git\n\na/(=http://server/y.git\n"), "team-map", nil)
+	var ruleErr *RuleError
+	if assert.True(t, errors.As(err, &ruleErr)) {
+		assert.Equal(t, "team-map", ruleErr.File)
+		assert.Equal(t, 3, ruleErr.Line)
+		assert.Equal(t, "a/(=http://server/y.git", ruleErr.Text)
+		assert.True(t, strings.HasPrefix(err.Error(), "team-map:3: "))
+	}
+
+	_, err = LoadRules(strings.NewReader("just some text\n"))
+	if assert.True(t, errors.As(err, &ruleErr)) {
+		assert.Equal(t, 1, ruleErr.Line)
+	}
+
+	_, err = NewRule("a/(", "http://server/y.git")
+	assert.NotNil(t, err)
+}
+
+func TestRuleMatches(t *testing.T) {
+	ruleSet, err := LoadRules(strings.NewReader(`a/hats=http://server/special_repos/hats.git
+a/([^/]+)=http://server/repos/$1.git
+a/hats/([^/]+)=http://server/unreachable/$1.git
+`))
+	assert.Nil(t, err)
+
+	matches := ruleSet.Matches("a/hats/top")
+	if !assert.Len(t, matches, 3) {
+		return
+	}
+	assert.Equal(t, 0, matches[0].Index)
+	assert.Equal(t, "a/hats", matches[0].Root)
+	assert.Equal(t, "http://server/special_repos/hats.git", matches[0].Url)
+	assert.Equal(t, "a/hats=http://server/special_repos/hats.git", matches[0].Rule.String())
+
+	assert.Equal(t, 1, matches[1].Index)
+	assert.Equal(t, "http://server/repos/hats.git", matches[1].Url)
+
+	assert.Equal(t, 2, matches[2].Index)
+	assert.Equal(t, "a/hats/top", matches[2].Root)
+	assert.Equal(t, "http://server/unreachable/top.git", matches[2].Url)
+
+	assert.Len(t, ruleSet.Matches("b/shoes"), 0)
+}
+
+func TestRulePins(t *testing.T) {
+	ruleSet, err := LoadRules(strings.NewReader(`a/hats=http://server/hats.git#release-2.x
+a/shoes=git@server:shoes.git@v1.4.0
+a/socks=ssh://git@server/socks.git
+`))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for pkg, expected := range map[string]Remote{
+		"a/hats":  {Root: "a/hats", Url: "http://server/hats.git", VCS: "git", Branch: "release-2.x"},
+		"a/shoes": {Root: "a/shoes", Url: "git@server:shoes.git", VCS: "git", Ref: "v1.4.0"},
+		"a/socks": {Root: "a/socks", Url: "ssh://git@server/socks.git", VCS: "git"},
+	} {
+		remote, err := ruleSet.Resolve(pkg)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, remote)
+	}
+}
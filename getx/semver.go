@@ -0,0 +1,257 @@
+package getx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//Tags are chosen by semantic version rather than by git describe. Tags that
+//don't parse as versions are ignored, as are pre-releases unless asked for.
+//A version may leave off its minor and patch numbers (v1, v1.10), they are
+//taken to be zero.
+
+type Version struct {
+	Major, Minor, Patch int
+	Pre                 string // Pre-release, without the leading -
+	Tag                 string // Tag the version was parsed from
+	parts               int    // How many of major, minor and patch were given
+}
+
+//ParseVersion parses a tag like v1.2.3, 1.2 or v2.0.0-rc.1+build. A bare
+//number is only a version with the v prefix, so date tags like 20160101
+//aren't taken to be a huge major version.
+func ParseVersion(tag string) (Version, bool) {
+	v, ok := parseVersion(tag)
+	if !ok || (v.parts == 1 && !strings.HasPrefix(tag, "v")) {
+		return Version{}, false
+	}
+	return v, true
+}
+
+//parseVersion parses a version allowing a bare major number, as constraints
+//do (>=2).
+func parseVersion(tag string) (Version, bool) {
+	v := Version{Tag: tag}
+	s := strings.TrimPrefix(tag, "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		s, v.Pre = s[:i], s[i+1:]
+		if v.Pre == "" {
+			return Version{}, false
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return Version{}, false
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || strings.HasPrefix(part, "+") {
+			return Version{}, false
+		}
+		*nums[i] = n
+	}
+	v.parts = len(parts)
+	return v, true
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+//Compare returns -1, 0 or 1 as v is lower than, equal to or higher than o.
+func (v Version) Compare(o Version) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+func sign(n int) int {
+	if n < 0 {
+		return -1
+	} else if n > 0 {
+		return 1
+	}
+	return 0
+}
+
+//comparePre orders pre-releases as semver does: a release is higher than any
+//of its pre-releases, numeric identifiers compare as numbers and are lower
+//than alphanumeric ones.
+func comparePre(a, b string) int {
+	if a == b {
+		return 0
+	} else if a == "" {
+		return 1
+	} else if b == "" {
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+type constraintTerm struct {
+	op string
+	v  Version
+}
+
+//Constraint is a comma separated list of version ranges, all of which must
+//be satisfied:
+//
+//	^1.2      >=1.2.0, <2.0.0 (for 0.x, <0.(x+1).0)
+//	~1.4.0    >=1.4.0, <1.5.0 (~1 is >=1.0.0, <2.0.0)
+//	>=2,<3    any of >, >=, <, <=, = followed by a version
+//	1.2.3     exactly 1.2.3
+type Constraint struct {
+	terms []constraintTerm
+	text  string
+}
+
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{text: s}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		op := ""
+		for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+			if strings.HasPrefix(part, prefix) {
+				op = prefix
+				break
+			}
+		}
+
+		v, ok := parseVersion(strings.TrimSpace(strings.TrimPrefix(part, op)))
+		if !ok {
+			return Constraint{}, fmt.Errorf("invalid version constraint %q", s)
+		}
+		v.Tag = ""
+
+		switch op {
+		case "^":
+			upper := Version{Major: v.Major + 1}
+			if v.Major == 0 && v.parts > 1 {
+				upper = Version{Minor: v.Minor + 1}
+			}
+			c.terms = append(c.terms, constraintTerm{">=", v}, constraintTerm{"<", upper})
+		case "~":
+			upper := Version{Major: v.Major, Minor: v.Minor + 1}
+			if v.parts == 1 {
+				upper = Version{Major: v.Major + 1}
+			}
+			c.terms = append(c.terms, constraintTerm{">=", v}, constraintTerm{"<", upper})
+		case "":
+			c.terms = append(c.terms, constraintTerm{"=", v})
+		default:
+			c.terms = append(c.terms, constraintTerm{op, v})
+		}
+	}
+	return c, nil
+}
+
+func (c Constraint) String() string { return c.text }
+
+//Check is true if v satisfies every range in the constraint.
+func (c Constraint) Check(v Version) bool {
+	for _, term := range c.terms {
+		cmp := v.Compare(term.v)
+		ok := false
+		switch term.op {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			//<2.0.0 shouldn't let in 2.0.0-rc.1
+			ok = cmp < 0 && !(v.Pre != "" && term.v.Pre == "" &&
+				Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch}.Compare(term.v) == 0)
+		case "=":
+			ok = cmp == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+//HighestVersion returns the highest of tags parsing as a version that
+//satisfies c (if not nil), skipping pre-releases unless prerelease is set.
+func HighestVersion(tags []string, c *Constraint, prerelease bool) (Version, bool) {
+	constraints := []Constraint{}
+	if c != nil {
+		constraints = append(constraints, *c)
+	}
+	versions := satisfying(tags, constraints, prerelease)
+	if len(versions) == 0 {
+		return Version{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+//LowestVersion returns the lowest of tags parsing as a version that
+//satisfies every one of constraints.
+func LowestVersion(tags []string, constraints []Constraint, prerelease bool) (Version, bool) {
+	versions := satisfying(tags, constraints, prerelease)
+	if len(versions) == 0 {
+		return Version{}, false
+	}
+	return versions[0], true
+}
+
+//satisfying returns the versions of tags satisfying every constraint, lowest
+//first. Ties between tags for the same version (v1.2 and v1.2.0) are broken
+//by name, so the choice doesn't depend on tag order.
+func satisfying(tags []string, constraints []Constraint, prerelease bool) []Version {
+	versions := []Version{}
+	for _, tag := range tags {
+		v, ok := ParseVersion(tag)
+		if !ok || (v.Pre != "" && !prerelease) {
+			continue
+		}
+		for _, c := range constraints {
+			ok = ok && c.Check(v)
+		}
+		if ok {
+			versions = append(versions, v)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		if cmp := versions[i].Compare(versions[j]); cmp != 0 {
+			return cmp < 0
+		}
+		return versions[i].Tag < versions[j].Tag
+	})
+	return versions
+}
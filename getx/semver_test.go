@@ -0,0 +1,123 @@
+package getx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, ok := ParseVersion("v1.10")
+	assert.True(t, ok)
+	assert.Equal(t, "1.10.0", v.String())
+
+	v, ok = ParseVersion("2.0.0-rc.1+build.5")
+	assert.True(t, ok)
+	assert.Equal(t, "rc.1", v.Pre)
+
+	for _, tag := range []string{"nightly-2016", "v1.2.3.4", "v1.x", "release", "v1.0.0-", "2016", "20160101"} {
+		_, ok := ParseVersion(tag)
+		assert.False(t, ok, tag)
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	ordered := []string{"v1.0.0-alpha", "v1.0.0-alpha.1", "v1.0.0-alpha.beta", "v1.0.0-beta.2",
+		"v1.0.0-beta.11", "v1.0.0-rc.1", "v1.0.0", "v1.9", "v1.10.0", "v2"}
+	for i := 1; i < len(ordered); i++ {
+		a, _ := ParseVersion(ordered[i-1])
+		b, _ := ParseVersion(ordered[i])
+		assert.Equal(t, -1, a.Compare(b), "%s < %s", ordered[i-1], ordered[i])
+		assert.Equal(t, 1, b.Compare(a), "%s > %s", ordered[i], ordered[i-1])
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	for constraint, cases := range map[string]map[string]bool{
+		"^1.2":   {"1.2.0": true, "1.9.3": true, "1.1.9": false, "2.0.0": false},
+		"^0.3":   {"0.3.1": true, "0.4.0": false},
+		"~1.4.0": {"1.4.7": true, "1.5.0": false, "1.3.9": false},
+		"~1":     {"1.9.0": true, "2.0.0": false},
+		">=2,<3": {"2.0.0": true, "2.99.0": true, "3.0.0": false, "3.0.0-rc.1": false, "1.9.0": false},
+		"1.2.3":  {"1.2.3": true, "1.2.4": false},
+	} {
+		c, err := ParseConstraint(constraint)
+		if !assert.Nil(t, err, constraint) {
+			continue
+		}
+		for version, expected := range cases {
+			v, _ := ParseVersion(version)
+			assert.Equal(t, expected, c.Check(v), "%s %s", version, constraint)
+		}
+	}
+
+	_, err := ParseConstraint("^one")
+	assert.NotNil(t, err)
+}
+
+func TestHighestVersion(t *testing.T) {
+	tags := []string{"nightly-2016", "v1.9", "v1.10.0", "v2.0.0-rc.1", "v0.9.0"}
+
+	v, ok := HighestVersion(tags, nil, false)
+	assert.True(t, ok)
+	assert.Equal(t, "v1.10.0", v.Tag)
+
+	v, _ = HighestVersion(tags, nil, true)
+	assert.Equal(t, "v2.0.0-rc.1", v.Tag)
+
+	c, _ := ParseConstraint("~1.9")
+	v, _ = HighestVersion(tags, &c, false)
+	assert.Equal(t, "v1.9", v.Tag)
+
+	c, _ = ParseConstraint(">=3")
+	_, ok = HighestVersion(tags, &c, false)
+	assert.False(t, ok)
+}
+
+func TestVersionTags(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		commands := []string{}
+		for _, tag := range []string{"v1.9", "v1.10.0", "nightly-2016", "v2.0.0-rc.1"} {
+			commands = append(commands, `git commit -q --allow-empty -m "`+tag+`"`, "git tag "+tag)
+		}
+		commands = append(commands, "git push -q --tags origin master")
+		upstreamf(t, format, ruleSet.Rules[0].Replace, commands...)
+		upstreamf(t, format, ruleSet.Rules[1].Replace, commands...)
+		ruleSet.Rules[1].Replace += "@~1.9"
+
+		p1Dir := filepath.Join(goPath[0], "src", "gh", "u1", "p1")
+		p2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		tagCommit := func(ctx *Context, goDir, tag string) string {
+			commit, _ := ctx.gitf(goDir, "rev-parse %s^{commit}", tag)
+			return commit
+		}
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, TaggedOnly)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, tagCommit(ctx, p1Dir, "v1.10.0"), ctx.head(p1Dir))
+		assert.Equal(t, tagCommit(ctx, p2Dir, "v1.9"), ctx.head(p2Dir))
+
+		os.RemoveAll(p1Dir)
+		os.RemoveAll(p2Dir)
+
+		//The rule's constraint still applies, without TaggedOnly
+		preCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Prerelease)
+		c, _ := ParseConstraint(">=1.10")
+		preCtx.SetConstraint(c)
+		assert.Nil(t, preCtx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, tagCommit(preCtx, p1Dir, "v2.0.0-rc.1"), preCtx.head(p1Dir))
+		assert.Equal(t, tagCommit(preCtx, p2Dir, "v1.9"), preCtx.head(p2Dir))
+	})
+}
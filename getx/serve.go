@@ -0,0 +1,68 @@
+package getx
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+//Handler serves the go-import meta tags go get (and discovery) looks for,
+//from the rules in a RuleSet, along with go-source for http(s) urls. Rules
+//match against the host the request was made to followed by its path, so a
+//vanity domain is served by rules like:
+//  go.example.org/([^/]+)=https://git.example.org/$1.git
+
+type Handler struct {
+	RuleSet RuleSet
+	Host    string // Used in place of the request host, if set
+}
+
+var metaTemplate = template.Must(template.New("meta").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta name="go-import" content="{{.Root}} {{.VCS}} {{.Url}}">
+{{if .Home}}<meta name="go-source" content="{{.Root}} {{.Home}} _ _">
+{{end}}</head>
+<body>
+go get {{.ImportPath}}
+</body>
+</html>
+`))
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := h.Host
+	if host == "" {
+		host = r.Host
+	}
+	importPath := strings.TrimSuffix(host+r.URL.Path, "/")
+
+	//Only the rules are used, a handler falling back to discovery could end
+	//up asking itself
+	matches := h.RuleSet.Matches(importPath)
+	if len(matches) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	match := matches[0]
+	page := &bytes.Buffer{}
+	err := metaTemplate.Execute(page, struct{ ImportPath, Root, VCS, Url, Home string }{
+		importPath, match.Root, match.VCS, match.Url, sourceHome(match.Url),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	page.WriteTo(w)
+}
+
+//sourceHome guesses a browsable home page for a repository url. Only http(s)
+//urls have one, ssh and scp style urls give "".
+func sourceHome(url string) string {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return ""
+	}
+	return strings.TrimSuffix(url, ".git")
+}
@@ -0,0 +1,57 @@
+package getx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServe(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(`[^/]+/a/hats=https://git.example.org/special/hats.git
+[^/]+/a/([^/]+)=https://git.example.org/$1.git
+`))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	server := httptest.NewTLSServer(&Handler{RuleSet: rules})
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "https://")
+
+	client := RuleSet{Discovery: NewDiscovery(server.Client())}
+	root, url, err := client.GetUrl(host + "/a/shoes/laces")
+	assert.Nil(t, err)
+	assert.Equal(t, host+"/a/shoes", root)
+	assert.Equal(t, "https://git.example.org/shoes.git", url)
+
+	discovered, err := client.Discovery.Discover(host + "/a/hats/top")
+	if assert.Nil(t, err) {
+		assert.Equal(t, host+"/a/hats", discovered.Import.Prefix)
+		assert.Equal(t, "https://git.example.org/special/hats.git", discovered.Import.RepoRoot)
+		if assert.NotNil(t, discovered.Source) {
+			assert.Equal(t, "https://git.example.org/special/hats", discovered.Source.Home)
+		}
+	}
+
+	resp, err := server.Client().Get(server.URL + "/b/socks?go-get=1")
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := &Handler{RuleSet: rules, Host: "go.example.org"}
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://localhost:8080/a/shoes?go-get=1", nil))
+	assert.Contains(t, recorder.Body.String(),
+		`<meta name="go-import" content="go.example.org/a/shoes git https://git.example.org/shoes.git">`)
+
+	sshRules, _ := LoadRules(strings.NewReader("go.example.org/b/([^/]+)=git@git.example.org:$1.git\n"))
+	recorder = httptest.NewRecorder()
+	handler = &Handler{RuleSet: sshRules}
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "http://go.example.org/b/socks?go-get=1", nil))
+	assert.Contains(t, recorder.Body.String(), `content="go.example.org/b/socks git git@git.example.org:socks.git"`)
+	assert.NotContains(t, recorder.Body.String(), "go-source")
+}
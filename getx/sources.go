@@ -0,0 +1,97 @@
+package getx
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/desal/dsutil"
+)
+
+//Rules can come from several files, merged so that the first matching rule
+//wins. In order of precedence:
+//  files given explicitly (the --rules flag)
+//  files listed in $GOGETX_RULES
+//  .go-getx-map in the working directory or the nearest parent containing one
+//  ~/.go-getx-map
+//  /etc/go-getx-map
+//Explicitly given files must exist, the others are skipped when missing.
+
+const (
+	RulesFilename = ".go-getx-map"
+	RulesEnvVar   = "GOGETX_RULES"
+	SystemRules   = "/etc/go-getx-map"
+)
+
+type RuleSource struct {
+	Path     string
+	Required bool // Fail rather than skip when the file doesn't exist
+}
+
+//DefaultRuleSources returns the rule files to load for workingDir, highest
+//precedence first, with files prepended.
+func DefaultRuleSources(workingDir string, files ...string) []RuleSource {
+	sources := []RuleSource{}
+	for _, file := range files {
+		sources = append(sources, RuleSource{expandHome(file), true})
+	}
+	for _, file := range filepath.SplitList(os.Getenv(RulesEnvVar)) {
+		if file != "" {
+			sources = append(sources, RuleSource{expandHome(file), true})
+		}
+	}
+	if projectRules, ok := findProjectRules(workingDir); ok {
+		sources = append(sources, RuleSource{projectRules, false})
+	}
+	sources = append(sources,
+		RuleSource{filepath.Join(dsutil.UserHomeDir(), RulesFilename), false},
+		RuleSource{SystemRules, false})
+	return sources
+}
+
+//findProjectRules walks up from dir looking for a rules file.
+func findProjectRules(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		filename := filepath.Join(dir, RulesFilename)
+		if dsutil.CheckPath(filename) {
+			return filename, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+//LoadRuleSources loads each source in turn and merges them into a single
+//RuleSet, keeping the order of sources. A file listed more than once is only
+//loaded the first time.
+func LoadRuleSources(sources []RuleSource) (RuleSet, error) {
+	loaded := stringSet{}
+	merged := RuleSet{}
+	for _, source := range sources {
+		path, err := filepath.Abs(source.Path)
+		if err != nil {
+			return RuleSet{}, err
+		}
+		if _, ok := loaded[path]; ok {
+			continue
+		}
+		loaded[path] = empty{}
+
+		if !source.Required && !dsutil.CheckPath(path) {
+			continue
+		}
+		ruleSet, err := LoadRulesFromFile(source.Path)
+		if err != nil {
+			return RuleSet{}, err
+		}
+		merged.Rules = append(merged.Rules, ruleSet.Rules...)
+		merged.addOverrides(ruleSet.Overrides)
+	}
+	return merged, nil
+}
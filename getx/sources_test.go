@@ -0,0 +1,71 @@
+package getx
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRules(t *testing.T, filename, rules string) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRuleSources(t *testing.T) {
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	project := filepath.Join(dir, "project")
+	t.Setenv("HOME", home)
+
+	writeRules(t, filepath.Join(dir, "team", "shared"), "a/([^/]+)=http://team/$1.git\nb/([^/]+)=http://team/$1.git\n")
+	writeRules(t, filepath.Join(home, RulesFilename), "include ../team/shared\nc/([^/]+)=http://user/$1.git\n")
+	writeRules(t, filepath.Join(project, RulesFilename), "b/([^/]+)=http://project/$1.git\n")
+	writeRules(t, filepath.Join(dir, "env"), "c/([^/]+)=http://env/$1.git\n")
+	writeRules(t, filepath.Join(dir, "flag"), "a/([^/]+)=http://flag/$1.git\n")
+	t.Setenv(RulesEnvVar, filepath.Join(dir, "env"))
+
+	sources := DefaultRuleSources(filepath.Join(project, "sub", "dir"), filepath.Join(dir, "flag"))
+	ruleSet, err := LoadRuleSources(sources)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for pkg, expected := range map[string]string{
+		"a/x": "http://flag/x.git",
+		"b/x": "http://project/x.git",
+		"c/x": "http://env/x.git",
+	} {
+		_, url, err := ruleSet.GetUrl(pkg)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, url, pkg)
+	}
+
+	matches := ruleSet.Matches("b/x")
+	if assert.Len(t, matches, 2) {
+		assert.Equal(t, filepath.Join(home, "../team/shared"), matches[1].Rule.File)
+	}
+
+	_, err = LoadRuleSources(DefaultRuleSources(project, filepath.Join(dir, "missing")))
+	assert.NotNil(t, err)
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeRules(t, filepath.Join(dir, "one"), "include two\n")
+	writeRules(t, filepath.Join(dir, "two"), "a/x=http://server/x.git\ninclude one\n")
+
+	_, err := LoadRulesFromFile(filepath.Join(dir, "one"))
+	var ruleErr *RuleError
+	if assert.True(t, errors.As(err, &ruleErr)) {
+		assert.Equal(t, 1, ruleErr.Line)
+	}
+	assert.Contains(t, err.Error(), "include cycle")
+}
@@ -0,0 +1,134 @@
+package getx
+
+import "sync"
+
+//Resolver state shared between workers, safe for concurrent use.
+
+type syncSet struct {
+	mu  sync.Mutex
+	set stringSet
+}
+
+func newSyncSet() *syncSet { return &syncSet{set: stringSet{}} }
+
+func (s *syncSet) Add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set[key] = empty{}
+}
+
+func (s *syncSet) Has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.set[key]
+	return ok
+}
+
+//Claim adds key to the set, returning false if it was already present.
+func (s *syncSet) Claim(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.set[key]; ok {
+		return false
+	}
+	s.set[key] = empty{}
+	return true
+}
+
+//DeleteFunc removes every key f returns true for.
+func (s *syncSet) DeleteFunc(f func(key string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, _ := range s.set {
+		if f(key) {
+			delete(s.set, key)
+		}
+	}
+}
+
+func (s *syncSet) Any(f func(key string) bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, _ := range s.set {
+		if f(key) {
+			return true
+		}
+	}
+	return false
+}
+
+type syncMap struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func newSyncMap() *syncMap { return &syncMap{m: map[string]string{}} }
+
+func (s *syncMap) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.m[key]
+	return v, ok
+}
+
+func (s *syncMap) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[key] = value
+}
+
+func (s *syncMap) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, key)
+}
+
+//Copy returns a snapshot that can be ranged over without holding the lock.
+func (s *syncMap) Copy() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := make(map[string]string, len(s.m))
+	for k, v := range s.m {
+		r[k] = v
+	}
+	return r
+}
+
+//keyedMutex hands out one mutex per key, used to stop two workers cloning or
+//updating the same repository.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newKeyedMutex() *keyedMutex { return &keyedMutex{locks: map[string]*sync.Mutex{}} }
+
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &sync.Mutex{}
+		k.locks[key] = l
+	}
+	k.mu.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+//workerPool limits how many git/go commands run at once. Slots are held
+//around clones, listing and the update of an existing repository, never
+//while fetching dependencies, and always taken after the repository's lock,
+//so it can't deadlock.
+type workerPool chan empty
+
+func newWorkerPool(n int) workerPool {
+	if n < 1 {
+		n = 1
+	}
+	return make(workerPool, n)
+}
+
+func (p workerPool) Size() int { return cap(p) }
+func (p workerPool) acquire()  { p <- empty{} }
+func (p workerPool) release()  { <-p }
@@ -0,0 +1,182 @@
+package getx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+//Status reports the state of repositories under each GOPATH src, without
+//changing them (other than fetching, if asked to).
+
+type RepoStatus struct {
+	Pkg        string `json:"pkg"`
+	Dir        string `json:"dir"`
+	VCS        string `json:"vcs"`
+	Branch     string `json:"branch,omitempty"` // "" if detached
+	Commit     string `json:"commit"`
+	Tag        string `json:"tag,omitempty"`
+	Dirty      bool   `json:"dirty,omitempty"`
+	Ahead      int    `json:"ahead,omitempty"`      // Local commits not upstream
+	Behind     int    `json:"behind,omitempty"`     // Upstream commits not checked out
+	NoUpstream bool   `json:"noUpstream,omitempty"` // Ahead and Behind are unknown
+	Origin     string `json:"origin,omitempty"`
+	RuleUrl    string `json:"ruleUrl,omitempty"`  // Url the rule set gives, "" if no rule matches
+	Override   string `json:"override,omitempty"` // Working copy linked in by an override
+}
+
+//Managed is true if a rule matches the repository.
+func (s RepoStatus) Managed() bool {
+	return s.RuleUrl != ""
+}
+
+//OriginMatches is true if origin is where the rule set would clone from.
+func (s RepoStatus) OriginMatches() bool {
+	return s.Origin == s.RuleUrl
+}
+
+//Status returns the status of every repository under GOPATH that a rule
+//matches, or with all every repository. With fetch, upstream is fetched
+//first so that Behind is current.
+func (c *Context) Status(all, fetch bool) ([]RepoStatus, error) {
+	statuses := []RepoStatus{}
+	for _, goPath := range c.goPath {
+		srcDir := filepath.Join(goPath, "src")
+		err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if path == srcDir && os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+
+			rel, _ := filepath.Rel(srcDir, path)
+			pkg := filepath.ToSlash(rel)
+
+			//Walk doesn't follow symlinks, which is what overrides are
+			override := ""
+			if info.Mode()&os.ModeSymlink != 0 {
+				if root, dir, ok := c.ruleSet.Override(pkg); ok && root == pkg {
+					override = dir
+				}
+			}
+			if (!info.IsDir() && override == "") || !isRepoRoot(path) {
+				return nil
+			}
+
+			vcs, isRepo := c.repoVCS(path)
+			if !isRepo {
+				return nil
+			}
+			remote, matched := c.ruleSet.ruleRemote(pkg)
+			if matched || override != "" || all {
+				s, err := c.repoStatus(vcs, pkg, path, remote, fetch)
+				if err != nil {
+					return err
+				}
+				s.Override = override
+				statuses = append(statuses, s)
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, c.errorf("Failed to walk %s: %s", srcDir, err.Error())
+		}
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Pkg < statuses[j].Pkg })
+	return statuses, nil
+}
+
+//isRepoRoot is a quick check for a repository's metadata in dir, before
+//asking each VCS about it.
+func isRepoRoot(dir string) bool {
+	for _, name := range vcsNames {
+		if _, err := os.Stat(filepath.Join(dir, "."+name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Context) repoStatus(vcs VCS, pkg, goDir string, remote Remote, fetch bool) (RepoStatus, error) {
+	s := RepoStatus{Pkg: pkg, Dir: goDir, VCS: vcs.Name(), RuleUrl: remote.Url}
+	if fetch {
+		if err := vcs.Fetch(goDir); err != nil {
+			c.warnf("Failed to fetch package %s (%s): %s", pkg, goDir, err.Error())
+		}
+	}
+
+	clean, _, err := vcs.Status(goDir)
+	if err != nil {
+		return s, c.errorf("Failed to get %s status for package %s (%s): %s",
+			vcs.Name(), pkg, goDir, err.Error())
+	}
+	s.Dirty = !clean
+	s.Branch, _ = vcs.Branch(goDir)
+	s.Commit, _ = vcs.Head(goDir)
+	s.Tag = exactTag(vcs, goDir)
+	s.Origin, _ = vcs.Origin(goDir)
+	if s.Ahead, s.Behind, err = vcs.AheadBehind(goDir); err != nil {
+		s.NoUpstream = true
+	}
+	return s, nil
+}
+
+func (s RepoStatus) branch() string {
+	if s.Branch != "" {
+		return s.Branch
+	} else if s.Tag != "" {
+		return "(detached at " + s.Tag + ")"
+	}
+	return "(detached at " + shortCommit(s.Commit) + ")"
+}
+
+func (s RepoStatus) upstream() string {
+	if s.NoUpstream {
+		return "-"
+	} else if s.Ahead == 0 && s.Behind == 0 {
+		return "up to date"
+	}
+	return fmt.Sprintf("+%d -%d", s.Ahead, s.Behind)
+}
+
+func (s RepoStatus) origin() string {
+	if s.Override != "" {
+		return "linked to " + s.Override
+	} else if !s.Managed() {
+		return "no rule"
+	} else if !s.OriginMatches() {
+		return "differs, rule gives " + s.RuleUrl
+	}
+	return "matches rule"
+}
+
+func WriteStatusTable(w io.Writer, statuses []RepoStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tBRANCH\tSTATE\tUPSTREAM\tORIGIN")
+	for _, s := range statuses {
+		state := "clean"
+		if s.Dirty {
+			state = "dirty"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.Pkg, s.branch(), state, s.upstream(), s.origin())
+	}
+	return tw.Flush()
+}
+
+func WriteStatusJSON(w io.Writer, statuses []RepoStatus) error {
+	b, err := json.MarshalIndent(statuses, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,73 @@
+package getx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/cmd"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+
+		p1Dir := filepath.Join(goPath[0], "src", "gh", "u1", "p1")
+		p2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		otherDir := filepath.Join(goPath[0], "src", "other", "x")
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(p1Dir, "scratch.txt"), []byte("scratch"), 0644))
+		assert.Nil(t, os.MkdirAll(otherDir, 0755))
+		for dir, command := range map[string]string{
+			p1Dir:    "git remote set-url origin http://elsewhere/p1.git",
+			p2Dir:    `git commit -q --allow-empty -m "local"`,
+			otherDir: "git init -q",
+		} {
+			_, _, err := cmd.New(dir, format, cmd.Warn).Execf(command)
+			assert.Nil(t, err)
+		}
+		upstreamf(t, format, ruleSet.Rules[1].Replace,
+			`git commit -q --allow-empty -m "upstream"`,
+			"git push -q origin master")
+
+		statuses, err := ctx.Status(false, true)
+		if !assert.Nil(t, err) || !assert.Len(t, statuses, 2) {
+			return
+		}
+
+		assert.Equal(t, "gh/u1/p1", statuses[0].Pkg)
+		assert.Equal(t, "master", statuses[0].Branch)
+		assert.True(t, statuses[0].Dirty)
+		assert.False(t, statuses[0].OriginMatches())
+
+		assert.Equal(t, "gh/u2/p1", statuses[1].Pkg)
+		assert.False(t, statuses[1].Dirty)
+		assert.Equal(t, 1, statuses[1].Ahead)
+		assert.Equal(t, 1, statuses[1].Behind)
+		assert.True(t, statuses[1].OriginMatches())
+
+		statuses, err = ctx.Status(true, false)
+		if assert.Nil(t, err) && assert.Len(t, statuses, 3) {
+			assert.Equal(t, "other/x", statuses[2].Pkg)
+			assert.False(t, statuses[2].Managed())
+			assert.True(t, statuses[2].NoUpstream)
+		}
+
+		var b bytes.Buffer
+		assert.Nil(t, WriteStatusTable(&b, statuses[1:2]))
+		assert.Equal(t, "PACKAGE   BRANCH  STATE  UPSTREAM  ORIGIN\ngh/u2/p1  master  clean  +1 -1     matches rule\n", b.String())
+	})
+}
@@ -2,6 +2,7 @@ package getx
 
 import (
 	"bytes"
+	"path/filepath"
 	"testing"
 
 	"github.com/desal/richtext"
@@ -466,6 +467,79 @@ func TestAccessing2SeparatePkgsFromSameRepoWithDistinctTransDeps(t *testing.T) {
 	)
 }
 
+func TestParallel(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1", "gh/u2/p2", "gh/u2/p3/s1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1", "gh/u3/p1"))
+	repos.AddRepo("gh/u2/p2",
+		Pkg("gh/u2/p2", "gh/u3/p1", "gh/u2/p3/s2"))
+	repos.AddRepo("gh/u2/p3",
+		Pkg("gh/u2/p3/s1", "gh/u3/p1"),
+		Pkg("gh/u2/p3/s2"))
+	repos.AddRepo("gh/u3/p1",
+		Pkg("gh/u3/p1"))
+
+	buf := &bytes.Buffer{}
+	fileList := repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(richtext.Debug(buf), goPath, ruleSet, "", Verbose, MustPanic, Install, RecurseTopLevel)
+		ctx.SetJobs(4)
+		ctx.Get(".", "gh/u1/p1", false, false)
+	})
+
+	expected := stringSet{
+		"./pkg/gh/u1/p1.a":         empty{},
+		"./pkg/gh/u2/p1.a":         empty{},
+		"./pkg/gh/u2/p2.a":         empty{},
+		"./pkg/gh/u2/p3/s1.a":      empty{},
+		"./pkg/gh/u2/p3/s2.a":      empty{},
+		"./pkg/gh/u3/p1.a":         empty{},
+		"./src/gh/u1/p1/gen.go":    empty{},
+		"./src/gh/u2/p1/gen.go":    empty{},
+		"./src/gh/u2/p2/gen.go":    empty{},
+		"./src/gh/u2/p3/s1/gen.go": empty{},
+		"./src/gh/u2/p3/s2/gen.go": empty{},
+		"./src/gh/u3/p1/gen.go":    empty{},
+	}
+	assert.Equal(t, expected, fileList)
+
+	//Dependencies are always installed before the packages importing them
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, "gh/u3/p1", lines[0])
+	assert.Equal(t, "gh/u1/p1", lines[4])
+
+	//Without RecurseTopLevel, several packages from one repository are
+	//updated one at a time
+	repos = NewRepos(format)
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1/s1", "gh/u2/p1/s2", "gh/u2/p1/s3", "gh/u2/p1/s4"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1/s1"),
+		Pkg("gh/u2/p1/s2"),
+		Pkg("gh/u2/p1/s3"),
+		Pkg("gh/u2/p1/s4"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		assert.Nil(t, New(format, goPath, ruleSet, "", MustPanic, DeepScan).Get(".", "gh/u1/p1", false, false))
+		head := upstreamf(t, format, ruleSet.Rules[1].Replace,
+			`git commit -q --allow-empty -m "upstream"`,
+			"git push -q origin master")
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, DeepScan, Update)
+		ctx.SetJobs(8)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, head, ctx.head(filepath.Join(goPath[0], "src", "gh", "u2", "p1")))
+		for _, r := range ctx.Results() {
+			assert.Nil(t, r.Skipped, r.Pkg)
+		}
+	})
+}
+
 func assertOutputEquivTo(t *testing.T, output string, expectedLines stringSet) {
 	actualLines := stringSet{}
 	for _, line := range strings.Split(output, "\n") {
@@ -0,0 +1,322 @@
+package getx
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/desal/dsutil"
+)
+
+//With the Transactional flag, Get snapshots every repository before cloning
+//or updating it. Several Gets can share one transaction between Begin and
+//Commit, otherwise each Get is its own. If anything fails, including
+//installs and the verify command, every repository is put back: updates are
+//reset to the commit they were on, and clones are removed. Local changes
+//stashed for an update are stashed again while it's reset, and put back
+//afterwards. The updated repositories that the failing packages import are
+//reported as suspects. Rolled back repositories are forgotten, so a later
+//Get fetches them again.
+
+type snapshot struct {
+	vcs     VCS
+	dir     string
+	branch  string // Branch checked out before the update, "" if detached
+	commit  string
+	cloned  bool
+	stashed bool // Local changes were stashed for the update
+}
+
+type transaction struct {
+	mu        sync.Mutex
+	snapshots map[string]snapshot // Keyed by root package
+	failed    []string            // Packages that failed to install
+	verify    string              // Command run in the named package after installing
+	open      bool                // Begin was called, Get leaves the commit to Commit
+	pkgs      []string            // Packages passed to Get since Begin
+}
+
+//RollbackError is returned by a Transactional Get that failed and put every
+//repository back.
+type RollbackError struct {
+	Err        error    // Why the transaction failed
+	Suspects   []string // Updated or cloned repositories the failure depends on
+	RolledBack []string
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%s\nRolled back %d repositories (%s), suspected: %s", e.Err.Error(),
+		len(e.RolledBack), strings.Join(e.RolledBack, ", "), strings.Join(e.Suspects, ", "))
+}
+
+func (e *RollbackError) Unwrap() error { return e.Err }
+
+//SetVerify sets a command (e.g. "go test ./...") run in the directory of
+//each package passed to a Transactional Get, once it has been installed.
+func (c *Context) SetVerify(command string) {
+	c.txn.verify = command
+}
+
+func (c *Context) snapshot(vcs VCS, rootPkg, goDir string, cloned bool) {
+	if !c.flags.Checked(Transactional) {
+		return
+	}
+	s := snapshot{vcs: vcs, dir: goDir, cloned: cloned}
+	if !cloned {
+		s.branch, _ = vcs.Branch(goDir)
+		s.commit, _ = vcs.Head(goDir)
+	}
+
+	c.txn.mu.Lock()
+	defer c.txn.mu.Unlock()
+	if _, ok := c.txn.snapshots[rootPkg]; !ok {
+		c.txn.snapshots[rootPkg] = s
+	}
+}
+
+//stashed records that the local changes to rootPkg were stashed for its
+//update, so rolling it back must keep them.
+func (c *Context) stashed(rootPkg string) {
+	c.txn.mu.Lock()
+	defer c.txn.mu.Unlock()
+	if s, ok := c.txn.snapshots[rootPkg]; ok {
+		s.stashed = true
+		c.txn.snapshots[rootPkg] = s
+	}
+}
+
+func (s snapshot) changed() bool {
+	if s.cloned {
+		return true
+	}
+	head, _ := s.vcs.Head(s.dir)
+	return head != s.commit
+}
+
+func (c *Context) installFailed(importPaths ...string) {
+	c.txn.mu.Lock()
+	defer c.txn.mu.Unlock()
+	c.txn.failed = append(c.txn.failed, importPaths...)
+}
+
+//Begin opens a transaction spanning every Get until Commit, so a failure in
+//one package rolls back the repositories updated for all of them. It does
+//nothing without the Transactional flag.
+func (c *Context) Begin() {
+	if !c.flags.Checked(Transactional) || c.flags.Checked(DryRun) {
+		return
+	}
+	c.txn.mu.Lock()
+	defer c.txn.mu.Unlock()
+	c.txn.snapshots = map[string]snapshot{}
+	c.txn.failed = nil
+	c.txn.pkgs = nil
+	c.txn.open = true
+}
+
+//Commit closes the transaction opened by Begin. errs are the errors returned
+//by its Gets. If there are any, or an install or the verify command failed,
+//every repository is rolled back and a RollbackError wrapping the first
+//failure is returned.
+func (c *Context) Commit(workingDir string, errs ...error) error {
+	c.txn.mu.Lock()
+	if !c.txn.open {
+		c.txn.mu.Unlock()
+		return nil
+	}
+	c.txn.open = false
+	pkgs := c.txn.pkgs
+	c.txn.mu.Unlock()
+
+	defer c.finishResults()
+	for _, err := range errs {
+		if err != nil {
+			return c.commitOrRollback(workingDir, pkgs, err)
+		}
+	}
+	return c.commitOrRollback(workingDir, pkgs, nil)
+}
+
+//getInTransaction runs a Get inside the open transaction, opening and
+//committing one of its own if there isn't one.
+func (c *Context) getInTransaction(workingDir, pkg string, depsOnly, tests bool) error {
+	c.txn.mu.Lock()
+	own := !c.txn.open
+	c.txn.mu.Unlock()
+	if own {
+		c.Begin()
+	}
+
+	c.txn.mu.Lock()
+	c.txn.pkgs = append(c.txn.pkgs, pkg)
+	c.txn.mu.Unlock()
+
+	err := c.getAndInstall(workingDir, pkg, depsOnly, tests)
+	if !own {
+		return err
+	}
+	return c.Commit(workingDir, err)
+}
+
+//commitOrRollback checks whether the transaction failed, and if so rolls it
+//back.
+func (c *Context) commitOrRollback(workingDir string, pkgs []string, err error) error {
+	c.txn.mu.Lock()
+	failed := append([]string{}, c.txn.failed...)
+	c.txn.mu.Unlock()
+
+	if err == nil && len(failed) > 0 {
+		err = newError(ErrInstall, strings.Join(pkgs, ", "), "", nil, "Failed to install %s", strings.Join(failed, ", "))
+	}
+	for _, pkg := range pkgs {
+		if err != nil || c.txn.verify == "" {
+			break
+		}
+		goDir, _ := c.goCtx.Dir(workingDir, pkg)
+		output, _, verifyErr := c.cmdCtx.Execf("cd %s && %s", dsutil.PosixPath(goDir), c.txn.verify)
+		if verifyErr != nil {
+			err = newError(ErrVerify, pkg, goDir, verifyErr, "'%s' failed for package %s (%s)\n%s",
+				c.txn.verify, pkg, goDir, strings.TrimSpace(output))
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	if len(failed) == 0 {
+		failed = pkgs
+	}
+	suspects := c.suspects(failed)
+	rolledBack := c.rollback(workingDir)
+	return c.report(&RollbackError{Err: err, Suspects: suspects, RolledBack: rolledBack})
+}
+
+//suspects returns the repositories changed in the transaction that any of
+//failed import, directly or not, or every changed repository if there are
+//none.
+func (c *Context) suspects(failed []string) []string {
+	c.txn.mu.Lock()
+	defer c.txn.mu.Unlock()
+
+	g, _ := c.Graph()
+	seen := stringSet{}
+	suspected := stringSet{}
+	var visit func(importPath string)
+	visit = func(importPath string) {
+		if _, ok := seen[importPath]; ok {
+			return
+		}
+		seen[importPath] = empty{}
+		node, ok := g.Packages[importPath]
+		if !ok {
+			return
+		}
+		if s, ok := c.txn.snapshots[node.Root]; ok && s.changed() {
+			suspected[node.Root] = empty{}
+		}
+		for _, imp := range node.Imports {
+			visit(imp)
+		}
+		for _, imp := range node.TestImports {
+			visit(imp)
+		}
+	}
+	for _, importPath := range failed {
+		visit(importPath)
+	}
+
+	if len(suspected) == 0 {
+		for rootPkg, s := range c.txn.snapshots {
+			if s.changed() {
+				suspected[rootPkg] = empty{}
+			}
+		}
+	}
+	suspects := []string{}
+	for rootPkg, _ := range suspected {
+		suspects = append(suspects, rootPkg)
+	}
+	sort.Strings(suspects)
+	return suspects
+}
+
+//rollback puts every repository in the transaction back the way it was, and
+//reinstalls those that were updated.
+func (c *Context) rollback(workingDir string) []string {
+	c.txn.mu.Lock()
+	snapshots := c.txn.snapshots
+	c.txn.snapshots = map[string]snapshot{}
+	c.txn.mu.Unlock()
+
+	rootPkgs := []string{}
+	for rootPkg, _ := range snapshots {
+		rootPkgs = append(rootPkgs, rootPkg)
+	}
+	sort.Strings(rootPkgs)
+
+	rolledBack := []string{}
+	for _, rootPkg := range rootPkgs {
+		s := snapshots[rootPkg]
+		if s.cloned {
+			if err := os.RemoveAll(s.dir); err != nil {
+				c.warnf("Failed to remove package %s (%s): %s", rootPkg, s.dir, err.Error())
+				continue
+			}
+			c.visited.Delete(rootPkg)
+			c.vcsCache.Delete(s.dir)
+			c.topCache.Delete(s.dir)
+		} else if !s.changed() {
+			continue
+		} else if !c.rollbackRepo(rootPkg, s) {
+			continue
+		} else if c.flags.Checked(Install) {
+			if err := c.goCtx.Install(workingDir, rootPkg+"/..."); err != nil {
+				c.warnf("%s/... Failed to reinstall after rolling back", rootPkg)
+			}
+		}
+
+		inRepo := func(pkg string) bool { return pkgContains(rootPkg, pkg) }
+		c.doneGit.DeleteFunc(inRepo)
+		c.doneGo.DeleteFunc(inRepo)
+
+		rolledBack = append(rolledBack, rootPkg)
+		c.result(rootPkg, s.dir, func(r *Result) {
+			r.RolledBack = true
+			if !s.cloned {
+				r.ToCommit = s.commit
+			}
+		})
+	}
+	return rolledBack
+}
+
+//rollbackRepo resets an updated repository to its snapshot, stashing any
+//local changes that were carried over the update and applying them again
+//afterwards.
+func (c *Context) rollbackRepo(rootPkg string, s snapshot) bool {
+	stashed := false
+	if s.stashed {
+		var err error
+		if stashed, err = s.vcs.Stash(s.dir); err != nil {
+			c.warnf("Not rolling back package %s (%s), Couldn't stash local changes: %s",
+				rootPkg, s.dir, err.Error())
+			return false
+		}
+	}
+
+	if err := s.vcs.Rollback(s.dir, s.branch, s.commit); err != nil {
+		c.warnf("Failed to roll back package %s (%s) to %s: %s", rootPkg, s.dir, s.commit, err.Error())
+		if stashed {
+			c.warnf("Local changes to package %s (%s) are stashed", rootPkg, s.dir)
+		}
+		return false
+	} else if stashed {
+		if err := s.vcs.Unstash(s.dir); err != nil {
+			c.warnf("Failed to unstash local changes to package %s (%s), they are still stashed: %s",
+				rootPkg, s.dir, err.Error())
+		}
+	}
+	return true
+}
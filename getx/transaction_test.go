@@ -0,0 +1,148 @@
+package getx
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/desal/dsutil"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		p1Dir := filepath.Join(goPath[0], "src", "gh", "u1", "p1")
+		p2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+
+		ctx := New(format, goPath, ruleSet, "", Warn, RecurseTopLevel, Install, Transactional)
+		ctx.SetVerify("false")
+		err := ctx.Get(".", "gh/u1/p1", false, false)
+		var rollbackErr *RollbackError
+		if assert.True(t, errors.As(err, &rollbackErr)) {
+			assert.True(t, errors.Is(err, ErrVerify))
+			assert.Equal(t, []string{"gh/u1/p1", "gh/u2/p1"}, rollbackErr.Suspects)
+			assert.Equal(t, []string{"gh/u1/p1", "gh/u2/p1"}, rollbackErr.RolledBack)
+		}
+		_, err = os.Stat(p1Dir)
+		assert.True(t, os.IsNotExist(err))
+		_, err = os.Stat(p2Dir)
+		assert.True(t, os.IsNotExist(err))
+
+		assert.Nil(t, New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Install, Transactional).
+			Get(".", "gh/u1/p1", false, false))
+
+		upstreamf(t, format, ruleSet.Rules[1].Replace,
+			`printf 'package p1\nfunc broken() {\n' > broken.go`,
+			"git add broken.go",
+			`git commit -q -m "broken"`,
+			"git push -q origin master")
+
+		ctx = New(format, goPath, ruleSet, "", Warn, RecurseTopLevel, Install, Update, Transactional)
+		p2Head := ctx.head(p2Dir)
+		err = ctx.Get(".", "gh/u1/p1", false, false)
+		if assert.True(t, errors.As(err, &rollbackErr)) {
+			assert.True(t, errors.Is(err, ErrInstall))
+			assert.Equal(t, []string{"gh/u2/p1"}, rollbackErr.Suspects)
+			assert.Equal(t, []string{"gh/u2/p1"}, rollbackErr.RolledBack)
+		}
+		assert.Equal(t, p2Head, ctx.head(p2Dir))
+
+		results := ctx.Results()
+		if assert.Len(t, results, 2) {
+			assert.False(t, results[0].RolledBack)
+			assert.True(t, results[1].RolledBack)
+			assert.False(t, results[1].Updated())
+		}
+	})
+}
+
+func TestTransactionStash(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		p2Url := ruleSet.Rules[1].Replace
+		upstreamf(t, format, p2Url,
+			"echo one > notes.txt && git add notes.txt",
+			`git commit -q -m "notes"`,
+			"git push -q origin master")
+		assert.Nil(t, New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel).
+			Get(".", "gh/u1/p1", false, false))
+
+		p2Dir := filepath.Join(goPath[0], "src", "gh", "u2", "p1")
+		notes := filepath.Join(p2Dir, "notes.txt")
+		assert.Nil(t, ioutil.WriteFile(notes, []byte("local\n"), 0644))
+		upstreamf(t, format, p2Url, `git commit -q --allow-empty -m "second"`, "git push -q origin master")
+
+		ctx := New(format, goPath, ruleSet, "", Warn, RecurseTopLevel, Update, Transactional)
+		ctx.SetUpdatePolicy(PolicyStash)
+		ctx.SetVerify("false")
+		p2Head := ctx.head(p2Dir)
+		err := ctx.Get(".", "gh/u1/p1", false, false)
+		var rollbackErr *RollbackError
+		if assert.True(t, errors.As(err, &rollbackErr)) {
+			assert.Equal(t, []string{"gh/u2/p1"}, rollbackErr.RolledBack)
+		}
+		assert.Equal(t, p2Head, ctx.head(p2Dir))
+
+		b, _ := ioutil.ReadFile(notes)
+		assert.Equal(t, "local\n", string(b))
+	})
+}
+
+func TestTransactionBegin(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1", "gh/u2/p1"))
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+	repos.AddRepo("gh/u3/p1",
+		Pkg("gh/u3/p1", "gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		ctx := New(format, goPath, ruleSet, "", Warn, RecurseTopLevel, Install, Transactional)
+		ctx.SetVerify("pwd | grep -qv u3")
+		ctx.Begin()
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		assert.Nil(t, ctx.Get(".", "gh/u3/p1", false, false))
+
+		err := ctx.Commit(".")
+		var rollbackErr *RollbackError
+		if assert.True(t, errors.As(err, &rollbackErr)) {
+			assert.True(t, errors.Is(err, ErrVerify))
+			assert.Equal(t, []string{"gh/u1/p1", "gh/u2/p1", "gh/u3/p1"}, rollbackErr.Suspects)
+			assert.Equal(t, []string{"gh/u1/p1", "gh/u2/p1", "gh/u3/p1"}, rollbackErr.RolledBack)
+		}
+		for _, pkg := range []string{"gh/u1/p1", "gh/u2/p1", "gh/u3/p1"} {
+			_, err := os.Stat(filepath.Join(goPath[0], "src", filepath.FromSlash(pkg)))
+			assert.True(t, os.IsNotExist(err), pkg)
+		}
+		assert.Empty(t, ctx.visited.Copy())
+
+		//Forgotten, so fetched again
+		ctx.SetVerify("")
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+		assert.True(t, dsutil.CheckPath(filepath.Join(goPath[0], "src", "gh", "u2", "p1")))
+	})
+}
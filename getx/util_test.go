@@ -66,7 +66,7 @@ func (r *Repos) Test(f func(goPath []string, ruleSet RuleSet)) stringSet {
 	if err != nil {
 		panic(err)
 	}
-	MockEnv(mockGoPath, RuleSet{rules}, f)
+	MockEnv(mockGoPath, RuleSet{Rules: rules}, f)
 
 	cmdCtx := cmd.New(mockGoPath, r.format, cmd.Warn)
 
@@ -149,7 +149,11 @@ func MockPackageBareGit(rootDir string, repo Repo, format richtext.Format) Rule
 	repoCtx.Execf(`git commit -m "init"`)
 	repoCtx.Execf("git push")
 
-	return NewRule(repo.BasePath, dsutil.PosixPath(barePath))
+	rule, err := NewRule(repo.BasePath, dsutil.PosixPath(barePath))
+	if err != nil {
+		panic(err)
+	}
+	return rule
 }
 
 func MockEnv(mockGoPath string, ruleSet RuleSet, f func(goPath []string, ruleSet RuleSet)) {
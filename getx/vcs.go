@@ -0,0 +1,86 @@
+package getx
+
+//Version control systems are hidden behind the VCS interface. Repositories
+//already on disk are detected by asking each backend in turn, new clones use
+//whichever VCS the rule (or discovered go-import tag) names, git by default.
+
+type VCS interface {
+	Name() string
+	IsRepo(dir string) bool
+	TopLevel(dir string) (string, error)
+	Clone(dir, url string) error
+	Status(dir string) (clean bool, status string, err error)
+	DefaultBranch(dir string) (string, error) // Branch updates pull into
+	KnownDefaultBranch(dir string) string     // DefaultBranch without asking origin or remembering it, "" if unknown
+	Branch(dir string) (string, error)        // Branch checked out, "" if detached
+	Checkout(dir, rev string) error
+	Pull(dir string) error
+	Fetch(dir string) error
+	Head(dir string) (string, error)
+	Tags(dir string) ([]string, error) // Tags pointing at the working copy
+	AllTags(dir string) ([]string, error)
+	HasCommit(dir, commit string) bool
+	Origin(dir string) (string, error)
+	SetOrigin(dir, url, keepAs string) error // Keep the old url as remote keepAs, unless ""
+	SetRemote(dir, name, url string) error
+	Log(dir, from, to string) ([]string, error)     // One line per commit in to but not from
+	Rollback(dir, branch, commit string) error      // Discard changes, put branch (or HEAD if "") back on commit
+	Commits(dir, from, to string) ([]string, error) // In to but not from, oldest first, first parents only
+	FastForward(dir string) error                   // Pull, failing if there are local commits
+	Rebase(dir string) error                        // Pull, rebasing local commits, left as it was on conflict
+	Stash(dir string) (bool, error)                 // Put aside changes to tracked files, false if none
+	Unstash(dir string) error                       // Apply the last Stash, left conflicted on failure
+	AheadBehind(dir string) (int, int, error)       // Commits only local, and only upstream, as of the last fetch
+	Behind(dir, remote, branch string) (int, error) // Commits on remote's branch not checked out, fetching first
+	RebaseOnto(dir, remote, branch string) error    // Rebase onto remote's branch, left as it was on conflict
+}
+
+//Names of the supported VCS, in the order they are detected.
+var vcsNames = []string{"git", "hg"}
+
+func isVCSName(name string) bool {
+	return stringInSlice(vcsNames, name)
+}
+
+func (c *Context) vcsNamed(name string) VCS {
+	for _, vcs := range c.vcs {
+		if vcs.Name() == name {
+			return vcs
+		}
+	}
+	return c.vcs[0]
+}
+
+//repoVCS finds the VCS of the repository containing goDir.
+func (c *Context) repoVCS(goDir string) (VCS, bool) {
+	if name, ok := c.vcsCache.Get(goDir); ok {
+		return c.vcsNamed(name), true
+	}
+	for _, vcs := range c.vcs {
+		if vcs.IsRepo(goDir) {
+			c.vcsCache.Set(goDir, vcs.Name())
+			return vcs, true
+		}
+	}
+	return nil, false
+}
+
+//head returns the commit checked out in goDir, or "" if it can't be found.
+func (c *Context) head(goDir string) string {
+	vcs, ok := c.repoVCS(goDir)
+	if !ok {
+		return ""
+	}
+	commit, _ := vcs.Head(goDir)
+	return commit
+}
+
+//exactTag returns a tag pointing at the commit checked out in goDir, or ""
+//if there isn't one.
+func exactTag(vcs VCS, goDir string) string {
+	tags, err := vcs.Tags(goDir)
+	if err != nil || len(tags) == 0 {
+		return ""
+	}
+	return tags[0]
+}
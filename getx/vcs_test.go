@@ -0,0 +1,153 @@
+package getx
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/desal/cmd"
+	"github.com/desal/dsutil"
+	"github.com/desal/richtext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleVCS(t *testing.T) {
+	ruleSet, err := LoadRules(strings.NewReader(`a/hats=hg+https://server/hats
+a/shoes=https://server/shoes vcs=hg
+a/([^/]+)=git+ssh://server/$1.git
+`))
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	for pkg, expected := range map[string]Remote{
+		"a/hats/top":  {Root: "a/hats", Url: "https://server/hats", VCS: "hg"},
+		"a/shoes":     {Root: "a/shoes", Url: "https://server/shoes", VCS: "hg"},
+		"a/socks/toe": {Root: "a/socks", Url: "git+ssh://server/socks.git", VCS: "git"},
+	} {
+		remote, err := ruleSet.Resolve(pkg)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, remote)
+	}
+	assert.Equal(t, "a/shoes=https://server/shoes vcs=hg", ruleSet.Rules[1].String())
+
+	_, err = LoadRules(strings.NewReader("a/x=https://server/x vcs=svn\n"))
+	assert.Contains(t, err.Error(), `unsupported vcs "svn"`)
+	_, err = LoadRules(strings.NewReader("a/x=https://server/x colour=red\n"))
+	assert.Contains(t, err.Error(), `unknown attribute "colour"`)
+	_, err = LoadRules(strings.NewReader("a/x=https://server/x hg\n"))
+	assert.Contains(t, err.Error(), "expected key=value")
+}
+
+func mockHgRepo(t *testing.T, format richtext.Format, dir string, pkg Package) {
+	mockPackage(dir, pkg.ImportPath, pkg.Imports)
+	hgCtx := cmd.New(dir, format, cmd.Warn)
+	for _, command := range []string{"hg init", "hg add -q", `hg commit -q -u test -m "init"`} {
+		if _, _, err := hgCtx.Execf(command); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHg(t *testing.T) {
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg not installed")
+	}
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+	repos.AddRepo("gh/u2/p1",
+		Pkg("gh/u2/p1"))
+
+	hgDir := t.TempDir()
+	mockHgRepo(t, format, hgDir, Pkg("hg/u1/p1", "gh/u2/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		hgRule, err := NewRule("hg/u1/p1", "hg+"+dsutil.PosixPath(hgDir))
+		if !assert.Nil(t, err) {
+			return
+		}
+		ruleSet.Rules = append(ruleSet.Rules, hgRule)
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "hg/u1/p1", false, false))
+
+		goDir := filepath.Join(goPath[0], "src", "hg", "u1", "p1")
+		assert.True(t, dsutil.CheckPath(filepath.Join(goDir, ".hg")))
+		assert.True(t, dsutil.CheckPath(filepath.Join(goPath[0], "src", "gh", "u2", "p1", ".git")))
+
+		lock, err := ctx.Lock()
+		assert.Nil(t, err)
+		if entry, ok := lock.Entry("hg/u1/p1"); assert.True(t, ok) {
+			assert.Equal(t, "hg", entry.VCS)
+			assert.Len(t, entry.Commit, 40)
+		}
+
+		//A new upstream commit is pulled by an update
+		hgCtx := cmd.New(hgDir, format, cmd.Warn)
+		_, _, err = hgCtx.Execf(`hg tag -u test v1.0.0`)
+		assert.Nil(t, err)
+		upstream, _, _ := hgCtx.Execf("hg log -r tip -T '{node}'")
+
+		updateCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update)
+		assert.Nil(t, updateCtx.Get(".", "hg/u1/p1", false, false))
+		assert.Equal(t, upstream, updateCtx.head(goDir))
+	})
+}
+
+func TestDefaultBranch(t *testing.T) {
+	format := richtext.Test(t)
+
+	repos := NewRepos(format)
+
+	repos.AddRepo("gh/u1/p1",
+		Pkg("gh/u1/p1"))
+
+	repos.Test(func(goPath []string, ruleSet RuleSet) {
+		bareUrl := ruleSet.Rules[0].Replace
+		upstreamf(t, format, bareUrl,
+			"git checkout -q -b main",
+			`git commit -q --allow-empty -m "on main"`,
+			"git push -q origin main",
+			"git -C "+bareUrl+" symbolic-ref HEAD refs/heads/main")
+
+		ctx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel)
+		assert.Nil(t, ctx.Get(".", "gh/u1/p1", false, false))
+
+		goDir := filepath.Join(goPath[0], "src", "gh", "u1", "p1")
+		remembered, _ := ctx.gitf(goDir, "config --get getx.defaultBranch")
+		assert.Equal(t, "main", remembered)
+
+		mainHead := upstreamf(t, format, bareUrl,
+			"git checkout -q main",
+			`git commit -q --allow-empty -m "main moved on"`,
+			"git push -q origin main")
+
+		updateCtx := New(format, goPath, ruleSet, "", MustPanic, RecurseTopLevel, Update)
+		assert.Nil(t, updateCtx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, mainHead, updateCtx.head(goDir))
+
+		//Forgotten, found again from origin
+		ctx.gitf(goDir, "config --unset getx.defaultBranch")
+		vcs, _ := ctx.repoVCS(goDir)
+		branch, err := vcs.DefaultBranch(goDir)
+		assert.Nil(t, err)
+		assert.Equal(t, "main", branch)
+
+		//A checkout left on another branch isn't switched away from
+		ctx.gitf(goDir, "checkout -q -b feature")
+		upstreamf(t, format, bareUrl,
+			"git checkout -q main",
+			`git commit -q --allow-empty -m "main moved on again"`,
+			"git push -q origin main")
+
+		featureCtx := New(format, goPath, ruleSet, "", RecurseTopLevel, Update)
+		assert.Nil(t, featureCtx.Get(".", "gh/u1/p1", false, false))
+		assert.Equal(t, mainHead, featureCtx.head(goDir))
+		results := featureCtx.Results()
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, []SkipReason{SkipOtherBranch}, results[0].Skipped)
+		}
+	})
+}
@@ -2,10 +2,11 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/desal/dsutil"
 	"github.com/desal/go-getx/getx"
 	"github.com/desal/gocmd"
 	"github.com/desal/richtext"
@@ -16,10 +17,27 @@ import (
 //a/hats=http://server/special_repos/hats.git
 //a/([^/]+)=http://server/repos/$1.git
 //b/([^/]+)=http://other/repos/$1.git
+//c/legacy=hg+https://hg.server/legacy
+//d/stable=http://server/repos/stable.git#release-2.x
+//d/frozen=http://server/repos/frozen.git@v1.4.0
+//d/stable-v1=http://server/repos/stable-v1.git@^1.2
+//e/scratch=http://server/repos/scratch.git update=stash
+//f/patched=http://server/forks/patched.git upstream=http://other/repos/patched.git
+//include ~/team/go-getx-map
+//override a/hats ~/work/hats
+
+//Extra rule files given with --rules, taking precedence over the others.
+var ruleFiles *[]string
+
+//Overrides given with --override, taking precedence over those in rule files.
+var overrides *[]string
 
 func main() {
 	app := cli.App("go-getx", "go get extended")
-	app.Spec = "[-d] [-v] [-i] [-f | -u] [-t] [--goflags] [PKG...]"
+	app.Spec = "[--rules...] [--override...] [-d] [-v] [-i] [-f | -u] [--policy] [--fix-origin [--keep-origin]] [--rebase-forks] [--log] [--rollback] [--verify] [-t] [-T] [--constraint] [--pre] [--goflags] [--lock] [-j] [-n] [--summary | --json] [-k] [PKG...]"
+
+	ruleFiles = app.StringsOpt("rules", nil, "Rule file to use ahead of $GOGETX_RULES, project, user and system rules (may be repeated)")
+	overrides = app.StringsOpt("override", nil, "ROOT=DIR, use the working copy in DIR for import root ROOT instead of cloning it (may be repeated)")
 
 	var (
 		dependencies = app.BoolOpt("d deps-only", false, "Do not fetch named packages, only their dependencies")
@@ -28,8 +46,24 @@ func main() {
 		install      = app.BoolOpt("i install", false, "Install all fetched packages (will continue if package fails to compile)")
 		fetch        = app.BoolOpt("f fetch-missing", false, "Performs a deep search for any missing dependencies and fetches them")
 		update       = app.BoolOpt("u update", false, "Updates package, and all transisitive depnediencs where possible")
+		policy       = app.StringOpt("policy", "skip", "With -u, what to do with local changes and commits: skip, stash, rebase or ff-only")
+		fixOrigin    = app.BoolOpt("fix-origin", false, "Point origin at the url the rules give, where it differs")
+		keepOrigin   = app.StringOpt("keep-origin", "", "With --fix-origin, keep the old url as a remote with this name")
+		rebaseForks  = app.BoolOpt("rebase-forks", false, "With -u, rebase forks (rules with upstream=url) onto their upstream, which must then be force pushed by hand")
+		changeLog    = app.BoolOpt("log", false, "With -u, list the commits pulled into each updated repository")
+		rollback     = app.BoolOpt("rollback", false, "Put every cloned or updated repository back if anything fails to install or verify")
+		verify       = app.StringOpt("verify", "", "With --rollback, command run in each named package after installing (e.g. 'go test ./...')")
 		tests        = app.BoolOpt("t tests", false, "Fetches tests for the named packages")
+		tagged       = app.BoolOpt("T tagged", false, "Checkout the highest version tag of every repository")
+		constraint   = app.StringOpt("c constraint", "", "Checkout the highest version tag satisfying this constraint (e.g. '^1.2', '>=2,<3') where the rule doesn't give one")
+		prerelease   = app.BoolOpt("pre", false, "Allow pre-release version tags")
 		buildFlags   = app.StringOpt("goflags", "", "Additional flags to parse to go install (e.g. '-tags netgo')")
+		lockFile     = app.StringOpt("l lock", "", "Write the commit of every repository cloned or inspected by this run to this lockfile (others already in GOPATH are left out)")
+		jobs         = app.IntOpt("j jobs", 1, "Number of repositories to clone and inspect concurrently")
+		dryRun       = app.BoolOpt("n dry-run", false, "Print what would be cloned, updated and installed without doing it")
+		summary      = app.BoolOpt("summary", false, "Print a table of what was done to each package")
+		jsonOut      = app.BoolOpt("json", false, "Print what was done to each package as JSON")
+		keepGoing    = app.BoolOpt("k keep-going", false, "Continue past failing packages and report every failure at the end")
 
 		pkgs = app.StringsArg("PKG", nil, "Packages")
 	)
@@ -40,26 +74,58 @@ func main() {
 			os.Exit(0)
 		}
 
-		ruleSet, err := getx.LoadRulesFromFile(filepath.Join(dsutil.UserHomeDir(), ".go-getx-map"))
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
-		}
+		ruleSet := loadRuleSet()
 
 		format := richtext.New()
 		flags := []getx.Flag{}
 		goFlags := []gocmd.Flag{}
 
+		//Without -f, whole repositories are fetched and updated, as graph and
+		//status do
 		if *fetch {
 			flags = append(flags, getx.DeepScan)
 		} else if *update {
-			flags = append(flags, getx.Update)
+			flags = append(flags, getx.Update, getx.RecurseTopLevel)
+		} else {
+			flags = append(flags, getx.RecurseTopLevel)
 		}
 
 		if *install {
 			flags = append(flags, getx.Install)
 		}
 
+		if *changeLog {
+			flags = append(flags, getx.ChangeLog)
+		}
+
+		if *fixOrigin {
+			flags = append(flags, getx.FixOrigin)
+		}
+
+		if *rebaseForks {
+			flags = append(flags, getx.RebaseForks)
+		}
+
+		if *rollback {
+			flags = append(flags, getx.Transactional)
+		}
+
+		if *dryRun {
+			flags = append(flags, getx.DryRun)
+		}
+
+		if *tagged {
+			flags = append(flags, getx.TaggedOnly)
+		}
+
+		if *prerelease {
+			flags = append(flags, getx.Prerelease)
+		}
+
+		if *keepGoing {
+			flags = append(flags, getx.KeepGoing)
+		}
+
 		if *verbose {
 			flags = append(flags, getx.Verbose)
 		} else if *veryverbose {
@@ -68,20 +134,73 @@ func main() {
 			goFlags = append(goFlags, gocmd.Verbose)
 		}
 
-		goPath, err := gocmd.EnvGoPath()
-		if err != nil {
-			format.ErrorLine("%s", err)
-			os.Exit(1)
-		}
+		goPath := envGoPath(format)
 
 		ctx := getx.New(format, goPath, ruleSet, *buildFlags, flags...)
+		ctx.SetJobs(*jobs)
+		ctx.SetVerify(*verify)
+		ctx.SetKeepOrigin(*keepOrigin)
+		if p, err := getx.ParseUpdatePolicy(*policy); err != nil {
+			format.ErrorLine("%s", err.Error())
+			os.Exit(1)
+		} else {
+			ctx.SetUpdatePolicy(p)
+		}
+		if *constraint != "" {
+			c, err := getx.ParseConstraint(*constraint)
+			if err != nil {
+				format.ErrorLine("%s", err.Error())
+				os.Exit(1)
+			}
+			ctx.SetConstraint(c)
+		}
+		errs := []error{}
+		ctx.Begin()
 		for _, pkg := range *pkgs {
-			ctx.Get(".", pkg, *dependencies, *tests)
+			err := ctx.Get(".", pkg, *dependencies, *tests)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		//A rollback wraps the first failure
+		if err := ctx.Commit(".", errs...); err != nil && len(errs) > 0 {
+			errs[0] = err
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+
+		if *dryRun {
+			for _, step := range ctx.Plan() {
+				format.PrintLine("%s", step.String())
+			}
+			if !*verbose && !*veryverbose {
+				for _, err := range errs {
+					format.ErrorLine("%s", err.Error())
+				}
+			}
+			if len(errs) > 0 {
+				os.Exit(1)
+			}
+			return
 		}
 
+		if *summary {
+			getx.WriteResultsTable(os.Stdout, ctx.Results())
+		} else if *jsonOut {
+			getx.WriteResultsJSON(os.Stdout, ctx.Results())
+		}
+		//The summary table already shows old and new commits, only repeat them for the log
+		if *update && !*jsonOut && (!*summary || *changeLog) {
+			getx.WriteUpdateReport(os.Stdout, ctx.Results())
+		}
+
+		if *lockFile != "" {
+			writeLock(format, ctx, *lockFile)
+		}
+
+		ok := len(errs) == 0
 		if *install {
 			goCtx := gocmd.New(format, goPath, *buildFlags, goFlags...)
-			ok := true
 			for _, pkg := range *pkgs {
 				err := goCtx.Install(".", pkg)
 				if err != nil {
@@ -89,12 +208,55 @@ func main() {
 					format.ErrorLine("Failed to install %s: %s", pkg, err.Error())
 				}
 			}
+		}
 
-			if !ok {
-				os.Exit(1)
+		//Verbose output already reported each failure as it happened
+		if !*verbose && !*veryverbose {
+			for _, err := range errs {
+				format.ErrorLine("%s", err.Error())
 			}
 		}
+
+		if !ok {
+			os.Exit(1)
+		}
 	}
 
+	app.Command("restore", "Clone and checkout the exact commits recorded in a lockfile", restore)
+	app.Command("graph", "Print the import graph of packages, cloning any missing repositories unless -n is given", graph)
+	app.Command("rules", "Inspect the rule set", rules)
+	app.Command("status", "Show the branch, local changes and upstream of each repository in GOPATH", status)
+	app.Command("bisect", "Find the repository update that broke a test command, starting from a lockfile", bisect)
+	app.Command("serve", "Serve go-import meta tags for the rule set, for plain go get", serve)
+
 	app.Run(os.Args)
 }
+
+func loadRuleSet() getx.RuleSet {
+	ruleSet, err := getx.LoadRuleSources(getx.DefaultRuleSources(".", *ruleFiles...))
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	for _, override := range *overrides {
+		kv := strings.SplitN(override, "=", 2)
+		if len(kv) != 2 {
+			fmt.Printf("Expected --override ROOT=DIR, got %s\n", override)
+			os.Exit(1)
+		} else if err := ruleSet.AddOverride(kv[0], kv[1]); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+	ruleSet.Discovery = getx.NewDiscovery(&http.Client{Timeout: 30 * time.Second})
+	return ruleSet
+}
+
+func envGoPath(format richtext.Format) []string {
+	goPath, err := gocmd.EnvGoPath()
+	if err != nil {
+		format.ErrorLine("%s", err)
+		os.Exit(1)
+	}
+	return goPath
+}
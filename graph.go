@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+
+	"github.com/desal/go-getx/getx"
+	"github.com/desal/richtext"
+	"github.com/jawher/mow.cli"
+)
+
+func graph(cmd *cli.Cmd) {
+	cmd.Spec = "[-t] [-n] [-j] [--format] PKG..."
+
+	var (
+		tests  = cmd.BoolOpt("t tests", false, "Include imports only used by tests")
+		dryRun = cmd.BoolOpt("n dry-run", false, "Do not clone missing repositories, their imports are left out of the graph")
+		jobs   = cmd.IntOpt("j jobs", 1, "Number of repositories to clone and inspect concurrently")
+		output = cmd.StringOpt("format", "tree", "Output format: tree, dot or json")
+
+		pkgs = cmd.StringsArg("PKG", nil, "Packages")
+	)
+
+	cmd.Action = func() {
+		format := richtext.New()
+		flags := []getx.Flag{getx.RecurseTopLevel, getx.DeepScan, getx.Warn}
+
+		if *dryRun {
+			flags = append(flags, getx.DryRun)
+		}
+
+		ctx := getx.New(format, envGoPath(format), loadRuleSet(), "", flags...)
+		ctx.SetJobs(*jobs)
+		ok := true
+		for _, pkg := range *pkgs {
+			if err := ctx.Get(".", pkg, false, *tests); err != nil {
+				ok = false
+			}
+		}
+
+		g, err := ctx.Graph()
+		if err != nil {
+			format.ErrorLine("%s", err)
+			os.Exit(1)
+		}
+
+		switch *output {
+		case "tree":
+			err = g.WriteTree(os.Stdout, *pkgs...)
+		case "dot":
+			err = g.WriteDot(os.Stdout)
+		case "json":
+			err = g.WriteJSON(os.Stdout)
+		default:
+			format.ErrorLine("Unknown graph format %s", *output)
+			os.Exit(1)
+		}
+
+		if err != nil {
+			format.ErrorLine("%s", err)
+			os.Exit(1)
+		}
+
+		//Failures were warned about as they happened, the graph is partial
+		if !ok {
+			os.Exit(1)
+		}
+	}
+}
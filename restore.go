@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+
+	"github.com/desal/go-getx/getx"
+	"github.com/desal/richtext"
+	"github.com/jawher/mow.cli"
+)
+
+func restore(cmd *cli.Cmd) {
+	cmd.Spec = "[-v] [-i] [--goflags] [LOCKFILE]"
+
+	var (
+		verbose    = cmd.BoolOpt("v verbose", false, "Verbose output")
+		install    = cmd.BoolOpt("i install", false, "Install all restored packages")
+		buildFlags = cmd.StringOpt("goflags", "", "Additional flags to parse to go install (e.g. '-tags netgo')")
+
+		lockFile = cmd.StringArg("LOCKFILE", "go-getx.lock", "Lockfile to restore")
+	)
+
+	cmd.Action = func() {
+		format := richtext.New()
+		flags := []getx.Flag{getx.RecurseTopLevel}
+
+		if *install {
+			flags = append(flags, getx.Install)
+		}
+
+		if *verbose {
+			flags = append(flags, getx.Verbose)
+		}
+
+		lock, err := getx.LoadLockFromFile(*lockFile)
+		if err != nil {
+			format.ErrorLine("%s", err)
+			os.Exit(1)
+		}
+
+		goPath := envGoPath(format)
+
+		ctx := getx.New(format, goPath, getx.RuleSet{}, *buildFlags, flags...)
+		if err := ctx.Restore(".", lock); err != nil {
+			format.ErrorLine("%s", err)
+			os.Exit(1)
+		}
+	}
+}
+
+func writeLock(format richtext.Format, ctx *getx.Context, filename string) {
+	lock, err := ctx.Lock()
+	if err != nil {
+		format.ErrorLine("Failed to create lockfile: %s", err.Error())
+		os.Exit(1)
+	}
+
+	err = getx.SaveLockToFile(filename, lock)
+	if err != nil {
+		format.ErrorLine("Failed to write lockfile %s: %s", filename, err.Error())
+		os.Exit(1)
+	}
+}
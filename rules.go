@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+
+	"github.com/desal/richtext"
+	"github.com/jawher/mow.cli"
+)
+
+func rules(cmd *cli.Cmd) {
+	cmd.Command("test", "Show which rules match import paths, without cloning anything", rulesTest)
+}
+
+func rulesTest(cmd *cli.Cmd) {
+	cmd.Spec = "IMPORT..."
+
+	var (
+		importPaths = cmd.StringsArg("IMPORT", nil, "Import paths to test")
+	)
+
+	cmd.Action = func() {
+		format := richtext.New()
+		ruleSet := loadRuleSet()
+
+		ok := true
+		for _, importPath := range *importPaths {
+			if root, dir, overridden := ruleSet.Override(importPath); overridden {
+				format.PrintLine("%s", importPath)
+				format.PrintLine("  root:  %s", root)
+				format.PrintLine("  link:  %s", dir)
+				continue
+			}
+
+			matches := ruleSet.Matches(importPath)
+			if len(matches) == 0 {
+				discovered, err := ruleSet.Discovery.Discover(importPath)
+				if err != nil {
+					format.ErrorLine("%s: no matching rule: %s", importPath, err.Error())
+					ok = false
+					continue
+				}
+				format.PrintLine("%s", importPath)
+				format.PrintLine("  rule:  (discovered)")
+				format.PrintLine("  root:  %s", discovered.Import.Prefix)
+				format.PrintLine("  url:   %s", discovered.Import.RepoRoot)
+				if discovered.Import.VCS != "git" {
+					format.PrintLine("  vcs:   %s", discovered.Import.VCS)
+				}
+				continue
+			}
+
+			match := matches[0]
+			format.PrintLine("%s", importPath)
+			format.PrintLine("  rule:  %s  %s", match.Rule.Location(), match.Rule.String())
+			format.PrintLine("  root:  %s", match.Root)
+			format.PrintLine("  url:   %s", match.Url)
+			if match.VCS != "git" {
+				format.PrintLine("  vcs:   %s", match.VCS)
+			}
+			if match.Branch != "" {
+				format.PrintLine("  pin:   branch %s", match.Branch)
+			} else if match.Ref != "" {
+				format.PrintLine("  pin:   %s", match.Ref)
+			} else if match.Constraint != "" {
+				format.PrintLine("  pin:   version %s", match.Constraint)
+			}
+			if match.Upstream != "" {
+				format.PrintLine("  fork:  of %s", match.Upstream)
+			}
+			for _, shadowed := range matches[1:] {
+				format.WarningLine("  also matched (shadowed): %s  %s  -> %s %s", shadowed.Rule.Location(),
+					shadowed.Rule.String(), shadowed.Root, shadowed.Url)
+			}
+		}
+
+		if !ok {
+			os.Exit(1)
+		}
+	}
+}
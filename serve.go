@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/desal/go-getx/getx"
+	"github.com/desal/richtext"
+	"github.com/jawher/mow.cli"
+)
+
+func serve(cmd *cli.Cmd) {
+	cmd.Spec = "[--addr] [--host]"
+
+	var (
+		addr = cmd.StringOpt("addr", ":8080", "Address to listen on")
+		host = cmd.StringOpt("host", "", "Import path host to match rules against, instead of the request host")
+	)
+
+	cmd.Action = func() {
+		format := richtext.New()
+		ruleSet := loadRuleSet()
+		ruleSet.Discovery = nil
+
+		format.PrintLine("Serving go-import meta tags for %d rules on %s", len(ruleSet.Rules), *addr)
+		err := http.ListenAndServe(*addr, &getx.Handler{RuleSet: ruleSet, Host: *host})
+		format.ErrorLine("%s", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"github.com/desal/go-getx/getx"
+	"github.com/desal/richtext"
+	"github.com/jawher/mow.cli"
+)
+
+func status(cmd *cli.Cmd) {
+	cmd.Spec = "[-a] [-f] [--json]"
+
+	var (
+		all     = cmd.BoolOpt("a all", false, "Every repository in GOPATH, not just those a rule matches")
+		fetch   = cmd.BoolOpt("f fetch", false, "Fetch each repository first, so behind counts are current")
+		jsonOut = cmd.BoolOpt("json", false, "Print the status of each repository as JSON")
+	)
+
+	cmd.Action = func() {
+		format := richtext.New()
+
+		ctx := getx.New(format, envGoPath(format), loadRuleSet(), "", getx.RecurseTopLevel, getx.Warn)
+		statuses, err := ctx.Status(*all, *fetch)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		if *jsonOut {
+			err = getx.WriteStatusJSON(os.Stdout, statuses)
+		} else {
+			err = getx.WriteStatusTable(os.Stdout, statuses)
+		}
+		if err != nil {
+			format.ErrorLine("%s", err)
+			os.Exit(1)
+		}
+	}
+}